@@ -0,0 +1,93 @@
+// Package allocation decides which lots an order is picked from
+package allocation
+
+import (
+	"fmt"
+	"rest/datastore"
+	"rest/model"
+	"sort"
+	"time"
+)
+
+// Service allocates First-Expired-First-Out: the lots closest to their expiry are picked first, lots
+// that have expired are never picked and lots that do not expire come last
+type Service struct {
+	lots model.LotAllocator
+	now  func() time.Time
+}
+
+type Option func(*Service)
+
+// WithClock replaces the clock that tells which lots have expired
+func WithClock(now func() time.Time) Option {
+	return func(s *Service) {
+		s.now = now
+	}
+}
+
+func NewService(lots model.LotAllocator, options ...Option) Service {
+	s := Service{lots: lots, now: time.Now}
+	for _, option := range options {
+		option(&s)
+	}
+	return s
+}
+
+// Allocate picks the units and takes them from the lots and the stock in one transaction
+func (s Service) Allocate(a model.Allocation) ([]model.Pick, error) {
+	if a.Quantity < 1 {
+		return nil, fmt.Errorf("%w: an allocation needs a positive quantity", datastore.ErrInvalid)
+	}
+	now := s.now()
+	return s.lots.AllocateLots(a, func(lots []model.Lot) ([]model.Pick, error) {
+		return Plan(lots, a.Quantity, now)
+	})
+}
+
+// Plan is the pick list for quantity units out of lots, it fails with ErrInsufficientStock when the
+// lots that have not expired hold fewer units
+func Plan(lots []model.Lot, quantity int, now time.Time) ([]model.Pick, error) {
+	usable := make([]model.Lot, 0, len(lots))
+	for _, lot := range lots {
+		if lot.Quantity > 0 && lot.ExpiredAt == nil && (lot.Expiry == nil || lot.Expiry.After(now)) {
+			usable = append(usable, lot)
+		}
+	}
+	sort.SliceStable(usable, func(i, j int) bool {
+		return firstExpired(usable[i], usable[j])
+	})
+
+	picks := []model.Pick{}
+	left := quantity
+	for _, lot := range usable {
+		if left == 0 {
+			break
+		}
+		take := lot.Quantity
+		if take > left {
+			take = left
+		}
+		picks = append(picks, model.Pick{LotId: lot.Id, LotNumber: lot.LotNumber, LocationId: lot.LocationId, Quantity: take, Expiry: lot.Expiry})
+		left -= take
+	}
+	if left > 0 {
+		return nil, fmt.Errorf("%w: %d of %d units can be picked from lots that have not expired", datastore.ErrInsufficientStock, quantity-left, quantity)
+	}
+	return picks, nil
+}
+
+// firstExpired orders lots by expiry, then by receipt so older stock of the same expiry goes first
+func firstExpired(a, b model.Lot) bool {
+	switch {
+	case a.Expiry == nil && b.Expiry != nil:
+		return false
+	case a.Expiry != nil && b.Expiry == nil:
+		return true
+	case a.Expiry != nil && !a.Expiry.Equal(*b.Expiry):
+		return a.Expiry.Before(*b.Expiry)
+	case !a.ReceivedAt.Equal(b.ReceivedAt):
+		return a.ReceivedAt.Before(b.ReceivedAt)
+	default:
+		return a.Id < b.Id
+	}
+}
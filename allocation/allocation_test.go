@@ -0,0 +1,73 @@
+package allocation
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"rest/datastore"
+	"rest/model"
+	"testing"
+	"time"
+)
+
+func day(d int) *time.Time {
+	t := time.Date(2024, 5, d, 0, 0, 0, 0, time.UTC)
+	return &t
+}
+
+func TestPlanPicksFirstExpiredFirst(t *testing.T) {
+
+	lots := []model.Lot{
+		{Id: 1, LotNumber: "A", LocationId: 1, Quantity: 5},
+		{Id: 2, LotNumber: "B", LocationId: 1, Quantity: 4, Expiry: day(20)},
+		{Id: 3, LotNumber: "C", LocationId: 2, Quantity: 3, Expiry: day(12)},
+		{Id: 4, LotNumber: "D", LocationId: 1, Quantity: 9, Expiry: day(9)},
+	}
+	picks, err := Plan(lots, 8, *day(10))
+
+	assert.Nil(t, err, "no error is expected")
+	assert.Equal(t, []model.Pick{
+		{LotId: 3, LotNumber: "C", LocationId: 2, Quantity: 3, Expiry: day(12)},
+		{LotId: 2, LotNumber: "B", LocationId: 1, Quantity: 4, Expiry: day(20)},
+		{LotId: 1, LotNumber: "A", LocationId: 1, Quantity: 1},
+	}, picks, "the expired lot is expected to be skipped and the lot without expiry to come last")
+}
+
+func TestPlanBreaksExpiryTiesOnReceipt(t *testing.T) {
+
+	lots := []model.Lot{
+		{Id: 1, LotNumber: "A", Quantity: 5, Expiry: day(20), ReceivedAt: *day(3)},
+		{Id: 2, LotNumber: "B", Quantity: 5, Expiry: day(20), ReceivedAt: *day(2)},
+	}
+	picks, _ := Plan(lots, 2, *day(10))
+
+	assert.Equal(t, 2, picks[0].LotId, "the older lot is expected first")
+	assert.Equal(t, 1, len(picks), "one lot is expected to cover the allocation")
+}
+
+func TestPlanFailureWithTooFewUnits(t *testing.T) {
+
+	lots := []model.Lot{
+		{Id: 1, LotNumber: "A", Quantity: 5, Expiry: day(20)},
+		{Id: 2, LotNumber: "B", Quantity: 5, Expiry: day(10)},
+	}
+	_, err := Plan(lots, 6, *day(10))
+
+	assert.True(t, errors.Is(err, datastore.ErrInsufficientStock), "insufficient stock is expected")
+}
+
+type fakeAllocator struct {
+	lots []model.Lot
+}
+
+func (f fakeAllocator) AllocateLots(a model.Allocation, plan func(lots []model.Lot) ([]model.Pick, error)) ([]model.Pick, error) {
+	return plan(f.lots)
+}
+
+func TestAllocateUsesTheClock(t *testing.T) {
+
+	lots := []model.Lot{{Id: 1, LotNumber: "A", Quantity: 5, Expiry: day(20)}}
+	service := NewService(fakeAllocator{lots: lots}, WithClock(func() time.Time { return *day(21) }))
+	_, err := service.Allocate(model.Allocation{ProductId: 3, Quantity: 1})
+
+	assert.True(t, errors.Is(err, datastore.ErrInsufficientStock), "the lot is expected to have expired by the clock")
+}
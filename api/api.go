@@ -2,120 +2,438 @@ package api
 
 import (
 	"encoding/json"
-	"errors"
+	"fmt"
 	"github.com/gorilla/mux"
 	_ "github.com/jinzhu/gorm/dialects/postgres"
 	"io/ioutil"
+	"mime"
 	"net/http"
+	"rest/datastore"
 	"rest/model"
-	//"rest/datastore"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// Cache-Control sent on product reads unless WithCacheControl says otherwise,
+// clients may keep a copy but have to revalidate it with the ETag or Last-Modified
+const defaultCacheControl = "no-cache"
+
 type Controller struct {
 	datastore model.Datastore
+	searcher model.Searcher
+	suggester model.Suggester
+	categories model.CategoryDatastore
+	stock model.StockDatastore
+	locations model.LocationDatastore
+	lots model.LotDatastore
+	allocator model.Allocator
+	expiry model.ExpiryDatastore
+	pricer model.Pricer
+	markdowns model.MarkdownDatastore
+	now func() time.Time
+	cacheControl string
+}
+
+// Option configures optional behaviour of a Controller
+type Option func(*Controller)
+
+// WithCacheControl sets the Cache-Control header of product reads
+func WithCacheControl(value string) Option {
+	return func(ctrl *Controller) {
+		ctrl.cacheControl = value
+	}
+}
+
+// WithSearcher enables GET /products/search
+func WithSearcher(searcher model.Searcher) Option {
+	return func(ctrl *Controller) {
+		ctrl.searcher = searcher
+	}
+}
+
+// WithStock enables POST /products/{id}/stock
+func WithStock(stock model.StockDatastore) Option {
+	return func(ctrl *Controller) {
+		ctrl.stock = stock
+	}
+}
+
+// WithClock replaces the clock reports are made by
+func WithClock(now func() time.Time) Option {
+	return func(ctrl *Controller) {
+		ctrl.now = now
+	}
+}
+
+// WithSuggester enables GET /products/suggest
+func WithSuggester(suggester model.Suggester) Option {
+	return func(ctrl *Controller) {
+		ctrl.suggester = suggester
+	}
 }
 
-func NewController(datastore model.Datastore) Controller{
-	return Controller {
+func NewController(datastore model.Datastore, opts ...Option) Controller{
+	ctrl := Controller {
 		datastore: datastore,
+		now: time.Now,
+		cacheControl: defaultCacheControl,
 	}
+	for _, opt := range opts {
+		opt(&ctrl)
+	}
+	return ctrl
 }
 
 func (ctrl Controller) CreateProd(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json") // to send json response
-	msg:=make(map[string]string)
 	jsn, _ := ioutil.ReadAll(r.Body)
+	body := ProductCreateRequest{}
+	if json.Unmarshal(jsn,&body) != nil{
+		writeProblem(w, r, 400, "request body is not valid JSON")
+		return
+	}
 	data := &model.Product{}
-	json.Unmarshal(jsn,data)
-	err := ValidateForCreate(data)
-	if err != nil{
-		w.WriteHeader(400)
-		msg["error"]=err.Error()
-		json.NewEncoder(w).Encode(msg)
-	} else{
-		err := ctrl.datastore.Create(data)
-		if err != nil { // to check if create causes an error
-			if strings.Contains(err.Error(), "duplicate key value violates unique constraint"){ // to check if create causes an integrity error
-				w.WriteHeader(400)
-				msg["error"]="name already exists"
-				json.NewEncoder(w).Encode(msg)
-			}
-		}else{
-			w.WriteHeader(201)
-			msg["error"]="created successfully"
-			json.NewEncoder(w).Encode(msg)
-		}
+	err := body.toModel(data)
+	if err == nil{
+		err = ctrl.datastore.Create(data)
+	}
+	if err != nil{
+		writeError(w, r, err)
+	}else{
+		w.Header().Set("Location", "/products/"+strconv.Itoa(data.Id))
+		ctrl.writeProduct(w, 201, *data)
 	}
 }
 func (ctrl Controller) DeleteProd(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json") // to send json response
-	msg:=make(map[string]string)
-	id := mux.Vars(r)["id"]
 	data := &model.Product{}
-	ctrl.datastore.Delete(data, id)
-	w.WriteHeader(200)
-	msg["msg"]="deleted successfully"
-	json.NewEncoder(w).Encode(msg)
+	id, err := pathID(r, "id")
+	if err == nil{
+		err = ctrl.datastore.GetProduct(id, data)
+	}
+	if err == nil && !ifMatch(r, *data){
+		err = datastore.ErrStale
+	}
+	if err == nil{
+		err = ctrl.datastore.Delete(data)
+	}
+	if err != nil{
+		writeError(w, r, err)
+	}else{
+		writeMessage(w, 200, "deleted successfully")
+	}
 }
 
+// ListProd lists one page of products, see parseProductQuery for the parameters.
+// Links to the neighbouring pages are sent in the Link header, and count=true adds X-Total-Count
 func (ctrl Controller) ListProd(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json") // to send json response
-	msg:=make(map[string]string)
-	params :=r.URL.Query()
-	var prod  = ctrl.datastore.GetCategorisedProducts(params)
-	if len(prod) == 0 {
-		w.WriteHeader(404)
-		msg["error"]="invalid category"
-		json.NewEncoder(w).Encode(msg)
+	q, err := parseProductQuery(r.URL.Query())
+	if err != nil{
+		writeError(w, r, err)
+		return
+	}
+	if err := ctrl.categoriesExist(q.Filters); err != nil{
+		writeError(w, r, err)
+		return
+	}
+	limit := q.Limit
+	q.Limit = limit + 1 // the extra row tells whether there is another page
+	prod, err := ctrl.datastore.GetCategorisedProducts(q)
+	q.Limit = limit
+	more := len(prod) > limit
+	if more && q.Before != nil{ // a backwards page overflows at its start
+		prod = prod[1:]
+	}else if more{
+		prod = prod[:limit]
+	}
+	total := 0
+	if err == nil && r.URL.Query().Get("count") == "true"{
+		total, err = ctrl.datastore.CountProducts(q)
+	}
+	if err != nil{
+		writeError(w, r, err)
 	}else{
-		w.WriteHeader(200)
-		json.NewEncoder(w).Encode(prod)
+		if links := pageLinks(r, q, prod, more); links != ""{
+			w.Header().Set("Link", links)
+		}
+		if r.URL.Query().Get("count") == "true"{
+			w.Header().Set("X-Total-Count", strconv.Itoa(total))
+		}
+		resp := make([]ProductResponse, len(prod))
+		for i, p := range prod {
+			resp[i], _ = ctrl.priced(p)
+		}
+		// no Last-Modified: rows that were deleted or left the page do not move the newest updated_at
+		ctrl.writeCacheable(w, r, "", time.Time{}, shapeProducts(resp, q.Fields))
+	}
+}
+
+// categoriesExist makes sure every category a listing asks for by id exists, so that an
+// unknown category is a 404 rather than an empty page
+func (ctrl Controller) categoriesExist(filters []model.Filter) error {
+	for _, f := range filters {
+		if f.Field != "categoryId" || (f.Op != model.OpEq && f.Op != model.OpIn && f.Op != model.OpUnder) {
+			continue
+		}
+		for _, id := range f.Values {
+			exists, err := ctrl.datastore.CategoryExists(id.(int))
+			if err != nil {
+				return err
+			}
+			if !exists {
+				return fmt.Errorf("%w: category %d does not exist", datastore.ErrNotFound, id)
+			}
+		}
+	}
+	return nil
+}
+
+// SearchProd finds products by name, best match first: GET /products/search?q=milk&limit=10
+func (ctrl Controller) SearchProd(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	limit, err := resultLimit(r.URL.Query().Get("limit"))
+	var errs []FieldError
+	if query == ""{
+		errs = append(errs, FieldError{Field: "q", Detail: "q is missing"})
+	}
+	if err != nil{
+		errs = append(errs, *err)
+	}
+	if len(errs) > 0{
+		writeValidation(w, r, ValidationError{Errors: errs})
+		return
+	}
+	hits, searchErr := ctrl.searcher.SearchProducts(query, limit)
+	if searchErr != nil{
+		writeError(w, r, searchErr)
+	}else{
+		results := newSearchResults(hits)
+		for i, hit := range hits {
+			results[i].ProductResponse, _ = ctrl.priced(hit.Product)
+		}
+		writeJSON(w, 200, results)
+	}
+}
+
+// SuggestProd completes product names as the user types: GET /products/suggest?prefix=mil&limit=10
+func (ctrl Controller) SuggestProd(w http.ResponseWriter, r *http.Request) {
+	prefix := strings.TrimSpace(r.URL.Query().Get("prefix"))
+	limit, err := resultLimit(r.URL.Query().Get("limit"))
+	var errs []FieldError
+	if prefix == ""{
+		errs = append(errs, FieldError{Field: "prefix", Detail: "prefix is missing"})
+	}
+	if err != nil{
+		errs = append(errs, *err)
+	}
+	if len(errs) > 0{
+		writeValidation(w, r, ValidationError{Errors: errs})
+		return
+	}
+	writeJSON(w, 200, newSuggestionResponses(ctrl.suggester.Suggest(prefix, limit)))
+}
+
+func (ctrl Controller) GetProd(w http.ResponseWriter, r *http.Request) {
+	data := &model.Product{}
+	fields, errs := parseFields(r.URL.Query())
+	if len(errs) > 0{
+		writeValidation(w, r, ValidationError{Errors: errs})
+		return
+	}
+	id, err := pathID(r, "id")
+	if err == nil && fields == nil{
+		err = ctrl.datastore.GetProduct(id, data)
+	}else if err == nil{
+		err = ctrl.datastore.GetProductFields(id, ctrl.loadFields(fields), data)
+	}
+	if err != nil{
+		writeError(w, r, err)
+	}else{
+		resp, modified := ctrl.priced(*data)
+		ctrl.writeCacheable(w, r, pricedETag(*data, resp.Markdown), modified, shapeProduct(resp, fields))
 	}
 }
 
 func (ctrl Controller) UpdateProd(w http.ResponseWriter, r *http.Request){
-	w.Header().Set("Content-Type", "application/json")
-	msg:=make(map[string]string)
-	id := mux.Vars(r)["id"]
 	data := &model.Product{}
-	err:=ctrl.datastore.GetProductForUpdate("id = ?", id,data)
+	id, err := pathID(r, "id")
+	if err == nil{
+		err = ctrl.datastore.GetProduct(id, data)
+	}
+	if err == nil && !ifMatch(r, *data){
+		err = datastore.ErrStale
+	}
 	if err != nil{
-		w.WriteHeader(404)
-		msg["error"]="product is not available"
-		json.NewEncoder(w).Encode(msg)
+		writeError(w, r, err)
+		return
+	}
+	jsn, _ := ioutil.ReadAll(r.Body)
+	body := ProductUpdateRequest{}
+	if json.Unmarshal(jsn,&body) != nil{
+		writeProblem(w, r, 400, "request body is not valid JSON")
+		return
+	}
+	err = body.toModel(data) // PUT replaces the product, so it is validated like a new one
+	if err == nil{
+		err = ctrl.datastore.Save(data)
+	}
+	if err != nil{
+		writeError(w, r, err)
 	}else{
-		jsn, _ := ioutil.ReadAll(r.Body)
-		json.Unmarshal(jsn,data)
-		if data.Price < 0{
-			w.WriteHeader(400)
-			msg["error"]="price is invalid"
-			json.NewEncoder(w).Encode(msg)
-		}else{
-			err = ctrl.datastore.Save(data)
-			if err != nil{ // to check if create causes an error
-				if strings.Contains(err.Error(), "duplicate key value violates unique constraint"){ // to check if create causes an integrity error
-					w.WriteHeader(400)
-					msg["error"]="name already exists"
-					json.NewEncoder(w).Encode(msg)
-				}
-			}else{
-				w.WriteHeader(201)
-				msg["error"]="updated successfully"
-				json.NewEncoder(w).Encode(msg)
-			}
+		ctrl.writeProduct(w, 200, *data)
+	}
+}
+
+// PatchProd applies a merge patch (RFC 7396) or a JSON patch (RFC 6902) to the product,
+// validates the result like a PUT and writes only the fields that changed
+func (ctrl Controller) PatchProd(w http.ResponseWriter, r *http.Request){
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != mergePatchType && mediaType != jsonPatchType{
+		w.Header().Set("Accept-Patch", mergePatchType+", "+jsonPatchType)
+		writeProblem(w, r, 415, "PATCH accepts "+mergePatchType+" or "+jsonPatchType)
+		return
+	}
+	data := &model.Product{}
+	id, err := pathID(r, "id")
+	if err == nil{
+		err = ctrl.datastore.GetProduct(id, data)
+	}
+	if err == nil && !ifMatch(r, *data){
+		err = datastore.ErrStale
+	}
+	if err != nil{
+		writeError(w, r, err)
+		return
+	}
+	jsn, _ := ioutil.ReadAll(r.Body)
+	updated := *data
+	current, _ := ctrl.priced(*data) // the patch applies to the representation GET serves
+	body, err := patchProduct(mediaType, jsn, current)
+	if err == nil{
+		err = body.toModel(&updated)
+	}
+	if err == nil{
+		if fields := changedFields(*data, updated); len(fields) > 0{
+			err = ctrl.datastore.Update(&updated, fields)
 		}
 	}
+	if err != nil{
+		writeError(w, r, err)
+	}else{
+		ctrl.writeProduct(w, 200, updated)
+	}
 }
 
+// AdjustStock adds the amounts of the body to the stock of the product and answers with the product
+func (ctrl Controller) AdjustStock(w http.ResponseWriter, r *http.Request){
+	id, err := pathID(r, "id")
+	if err != nil{
+		writeError(w, r, err)
+		return
+	}
+	jsn, _ := ioutil.ReadAll(r.Body)
+	body := StockAdjustmentRequest{}
+	if json.Unmarshal(jsn,&body) != nil{
+		writeProblem(w, r, 400, "request body is not valid JSON")
+		return
+	}
+	data := &model.Product{}
+	adj, err := body.toModel(id, r.Header.Get("X-Actor"))
+	if err == nil{
+		err = ctrl.stock.AdjustStock(adj, data)
+	}
+	if err != nil{
+		writeError(w, r, err)
+	}else{
+		ctrl.writeProduct(w, 200, *data)
+	}
+}
+
+// TransferStock moves units of the product between two locations
+func (ctrl Controller) TransferStock(w http.ResponseWriter, r *http.Request){
+	id, err := pathID(r, "id")
+	if err != nil{
+		writeError(w, r, err)
+		return
+	}
+	jsn, _ := ioutil.ReadAll(r.Body)
+	body := StockTransferRequest{}
+	if json.Unmarshal(jsn,&body) != nil{
+		writeProblem(w, r, 400, "request body is not valid JSON")
+		return
+	}
+	from, to := &model.StockLevel{}, &model.StockLevel{}
+	transfer, err := body.toModel(id, r.Header.Get("X-Actor"))
+	if err == nil{
+		err = ctrl.stock.TransferStock(transfer, from, to)
+	}
+	if err != nil{
+		writeError(w, r, err)
+	}else{
+		writeJSON(w, 200, StockTransferResponse{From: newStockLevelResponse(*from), To: newStockLevelResponse(*to)})
+	}
+}
+
+// ListMovements pages through the stock ledger of a product, newest first, by limit and offset
+func (ctrl Controller) ListMovements(w http.ResponseWriter, r *http.Request){
+	params := r.URL.Query()
+	limit, limitErr := resultLimit(params.Get("limit"))
+	offset, offsetErr := offsetParam(params.Get("offset"))
+	var errs []FieldError
+	for _, err := range []*FieldError{limitErr, offsetErr}{
+		if err != nil{
+			errs = append(errs, *err)
+		}
+	}
+	if len(errs) > 0{
+		writeValidation(w, r, ValidationError{Errors: errs})
+		return
+	}
+	id, err := pathID(r, "id")
+	if err == nil{
+		err = ctrl.datastore.GetProduct(id, &model.Product{})
+	}
+	var movements []model.StockMovement
+	if err == nil{
+		movements, err = ctrl.stock.ListMovements(id, limit+1, offset)
+	}
+	if err != nil{
+		writeError(w, r, err)
+		return
+	}
+	more := len(movements) > limit
+	if more{
+		movements = movements[:limit]
+	}
+	if links := offsetLinks(r, offset, limit, more); links != ""{
+		w.Header().Set("Link", links)
+	}
+	writeJSON(w, 200, newMovementResponses(movements))
+}
+
+// pathID reads a numeric path variable such as {id} or {lotId}, ids that are not numbers cannot match
+// a record
+func pathID(r *http.Request, name string) (int, error) {
+	id, err := strconv.Atoi(mux.Vars(r)[name])
+	if err != nil{
+		return 0, datastore.ErrNotFound
+	}
+	return id, nil
+}
+
+// ValidateForCreate reports every missing or invalid field of a new product at once
 func ValidateForCreate(data *model.Product) (err error){
+	var errs []FieldError
 	if data.Name==""{
-		return errors.New("name is missing")
-	}else if data.Price <= 0{
-		return errors.New("price is missing or invalid")
-	}else if data.CategoryId == 0{
-		return errors.New("category is missing")
-	}else{
-		return nil
+		errs = append(errs, FieldError{Field: "name", Detail: "name is missing"})
+	}
+	if data.Price <= 0{
+		errs = append(errs, FieldError{Field: "price", Detail: "price is missing or invalid"})
+	}
+	if data.CategoryId == 0{
+		errs = append(errs, FieldError{Field: "categoryId", Detail: "category is missing"})
+	}
+	if len(errs) > 0{
+		return ValidationError{Errors: errs}
 	}
+	return nil
 }
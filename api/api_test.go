@@ -4,18 +4,38 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/golang/mock/gomock"
-	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
 	"net/http"
 	"net/http/httptest"
+	"rest/datastore"
 	"rest/mocks"
 	"rest/model"
-	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
 
+// productBody is the request body a client sends for prod
+func productBody(prod *model.Product) *bytes.Buffer {
+	jprod, _ := json.Marshal(ProductCreateRequest{
+		Name: prod.Name,
+		Price: prod.Price,
+		Expiry: formatExpiry(prod.Expiry),
+		CategoryId: prod.CategoryId,
+	})
+	return bytes.NewBuffer(jprod)
+}
+
+// stored fakes a GetProduct lookup that finds prod
+func stored(prod model.Product) func(int, *model.Product) error {
+	return func(id int, data *model.Product) error {
+		*data = prod
+		return nil
+	}
+}
+
 func TestCreateFailureWithNoName(t *testing.T) {
 
 	mockCtrl := gomock.NewController(t)
@@ -24,16 +44,14 @@ func TestCreateFailureWithNoName(t *testing.T) {
 	mockDatastore := mocks.NewMockDatastore(mockCtrl)
 	ctrl := NewController(mockDatastore)
 
-	myRouter := mux.NewRouter().StrictSlash(true)
-	myRouter.HandleFunc("/create",ctrl.CreateProd).Methods("POST")
+	myRouter := NewRouter(ctrl)
 
 	prod := &model.Product{
 		Name: "",
 		Price: 34.0,
 		CategoryId: 1,
 	}
-	jprod, _ := json.Marshal(prod)
-	req, _ := http.NewRequest("POST", "/create", bytes.NewBuffer(jprod))
+	req, _ := http.NewRequest("POST", "/products", productBody(prod))
 	resp := httptest.NewRecorder()
 	myRouter.ServeHTTP(resp, req)
 
@@ -48,16 +66,14 @@ func TestCreateFailureWithNoPrice(t *testing.T) {
 	mockDatastore := mocks.NewMockDatastore(mockCtrl)
 	ctrl := NewController(mockDatastore)
 
-	myRouter := mux.NewRouter().StrictSlash(true)
-	myRouter.HandleFunc("/create",ctrl.CreateProd).Methods("POST")
+	myRouter := NewRouter(ctrl)
 
 	prod := &model.Product{
 		Name: "prod11",
 		Price: 0,
 		CategoryId: 1,
 	}
-	jprod, _ := json.Marshal(prod)
-	req, _ := http.NewRequest("POST", "/create", bytes.NewBuffer(jprod))
+	req, _ := http.NewRequest("POST", "/products", productBody(prod))
 	resp := httptest.NewRecorder()
 	myRouter.ServeHTTP(resp, req)
 
@@ -71,16 +87,14 @@ func TestCreateFailureWithInvalidPrice(t *testing.T) {
 	mockDatastore := mocks.NewMockDatastore(mockCtrl)
 	ctrl := NewController(mockDatastore)
 
-	myRouter := mux.NewRouter().StrictSlash(true)
-	myRouter.HandleFunc("/create",ctrl.CreateProd).Methods("POST")
+	myRouter := NewRouter(ctrl)
 
 	prod := &model.Product{
 		Name: "prod11",
 		Price: -89,
 		CategoryId: 1,
 	}
-	jprod, _ := json.Marshal(prod)
-	req, _ := http.NewRequest("POST", "/create", bytes.NewBuffer(jprod))
+	req, _ := http.NewRequest("POST", "/products", productBody(prod))
 	resp := httptest.NewRecorder()
 	myRouter.ServeHTTP(resp, req)
 
@@ -95,16 +109,14 @@ func TestCreateFailureWithNoCategory(t *testing.T) {
 	mockDatastore := mocks.NewMockDatastore(mockCtrl)
 	ctrl := NewController(mockDatastore)
 
-	myRouter := mux.NewRouter().StrictSlash(true)
-	myRouter.HandleFunc("/create",ctrl.CreateProd).Methods("POST")
+	myRouter := NewRouter(ctrl)
 
 	prod := &model.Product{
 		Name: "prod11",
 		Price: 45,
 		CategoryId: 0,
 	}
-	jprod, _ := json.Marshal(prod)
-	req, _ := http.NewRequest("POST", "/create", bytes.NewBuffer(jprod))
+	req, _ := http.NewRequest("POST", "/products", productBody(prod))
 	resp := httptest.NewRecorder()
 	myRouter.ServeHTTP(resp, req)
 
@@ -122,15 +134,13 @@ func TestCreateFailureWithDuplicateName(t *testing.T) {
 		Price: 34,
 		CategoryId: 1,
 	}
-	mockDatastore.EXPECT().Create(prod).Return(errors.New("duplicate key value violates unique constraint"))
-	jprod, _ := json.Marshal(prod)
-	req, _ := http.NewRequest("POST", "/create", bytes.NewBuffer(jprod))
+	mockDatastore.EXPECT().Create(prod).Return(datastore.ConflictError{Field: "name"})
+	req, _ := http.NewRequest("POST", "/products", productBody(prod))
 	resp := httptest.NewRecorder()
-	myRouter := mux.NewRouter().StrictSlash(true)
-	myRouter.HandleFunc("/create",ctrl.CreateProd).Methods("POST")
+	myRouter := NewRouter(ctrl)
 	myRouter.ServeHTTP(resp, req)
 
-	assert.Equal(t, 400, resp.Code, "Bad Request is expected")
+	assert.Equal(t, 409, resp.Code, "Conflict is expected")
 }
 
 func TestCreateSuccess(t *testing.T) {
@@ -144,15 +154,20 @@ func TestCreateSuccess(t *testing.T) {
 		Price: 34,
 		CategoryId: 1,
 	}
-	mockDatastore.EXPECT().Create(prod).Return(nil)
-	jprod, _ := json.Marshal(prod)
-	req, _ := http.NewRequest("POST", "/create", bytes.NewBuffer(jprod))
+	mockDatastore.EXPECT().Create(prod).DoAndReturn(func(prod *model.Product) error {
+		prod.Id = 7 // the database assigns the id
+		return nil
+	})
+	req, _ := http.NewRequest("POST", "/products", productBody(prod))
 	resp := httptest.NewRecorder()
-	myRouter := mux.NewRouter().StrictSlash(true)
-	myRouter.HandleFunc("/create",ctrl.CreateProd).Methods("POST")
+	myRouter := NewRouter(ctrl)
 	myRouter.ServeHTTP(resp, req)
 
 	assert.Equal(t, 201, resp.Code, "Created successfully is expected")
+	assert.Equal(t, "/products/7", resp.Header().Get("Location"), "Location of the new product is expected")
+	body := ProductResponse{}
+	json.NewDecoder(resp.Body).Decode(&body)
+	assert.Equal(t, ProductResponse{Id: 7, Name: "prod100", Price: 34, CategoryId: 1}, body, "stored product is expected")
 }
 
 func TestDeleteFailureWithInvalidID(t *testing.T) {
@@ -161,17 +176,13 @@ func TestDeleteFailureWithInvalidID(t *testing.T) {
 	defer mockCtrl.Finish()
 	mockDatastore := mocks.NewMockDatastore(mockCtrl)
 	ctrl := NewController(mockDatastore)
-	//prod := &model.Product{}
-	i:= strconv.Itoa(4200) // 2nd arg of delete is string not int
-	mockDatastore.EXPECT().Delete(&model.Product{},i)
-	//jprod, _ := json.Marshal(prod)
-	req, _ := http.NewRequest("DELETE", "/delete/4200",nil)
+	mockDatastore.EXPECT().GetProduct(4200,&model.Product{}).Return(datastore.ErrNotFound)
+	req, _ := http.NewRequest("DELETE", "/products/4200",nil)
 	resp := httptest.NewRecorder()
-	myRouter := mux.NewRouter().StrictSlash(true) // need to specify router because server is not running while creaing tests
-	myRouter.HandleFunc("/delete/{id}",ctrl.DeleteProd).Methods("DELETE")
+	myRouter := NewRouter(ctrl)
 	myRouter.ServeHTTP(resp, req)
 
-	assert.Equal(t, 200, resp.Code, "deleted successfully is expexted")
+	assert.Equal(t, 404, resp.Code, "Not Found is expected")
 }
 
 func TestDeleteSuccessWithValidID(t *testing.T) {
@@ -180,14 +191,11 @@ func TestDeleteSuccessWithValidID(t *testing.T) {
 	defer mockCtrl.Finish()
 	mockDatastore := mocks.NewMockDatastore(mockCtrl)
 	ctrl := NewController(mockDatastore)
-	//prod := &model.Product{}
-	i:= strconv.Itoa(2) // 2nd arg of delete is string not int
-	mockDatastore.EXPECT().Delete(&model.Product{},i)
-	//jprod, _ := json.Marshal(prod)
-	req, _ := http.NewRequest("DELETE", "/delete/2",nil)
+	mockDatastore.EXPECT().GetProduct(2,&model.Product{}).DoAndReturn(stored(model.Product{Id: 2, Name: "prod2", Price: 20, CategoryId: 1, Version: 1}))
+	mockDatastore.EXPECT().Delete(&model.Product{Id: 2, Name: "prod2", Price: 20, CategoryId: 1, Version: 1}).Return(nil)
+	req, _ := http.NewRequest("DELETE", "/products/2",nil)
 	resp := httptest.NewRecorder()
-	myRouter := mux.NewRouter().StrictSlash(true) // need to specify router because server is not running while creaing tests
-	myRouter.HandleFunc("/delete/{id}",ctrl.DeleteProd).Methods("DELETE")
+	myRouter := NewRouter(ctrl)
 	myRouter.ServeHTTP(resp, req)
 
 	assert.Equal(t, 200, resp.Code, "deleted successfully is expexted")
@@ -200,19 +208,15 @@ func TestUpdateFailureWithInvalidId(t *testing.T) {
 	mockDatastore := mocks.NewMockDatastore(mockCtrl)
 	ctrl := NewController(mockDatastore)
 	prod := &model.Product{}
-	query:="id = ?"
-	i:= strconv.Itoa(20000)
-	mockDatastore.EXPECT().GetProductForUpdate(query,i,prod).Return(errors.New("product is not available"))
+	mockDatastore.EXPECT().GetProduct(20000,prod).Return(datastore.ErrNotFound)
 	newprod := &model.Product{
 		Name: "prod32",
 		Price: 55,
 		CategoryId: 2,
 	}
-	jprod, _ := json.Marshal(newprod)
-	req, _ := http.NewRequest("PUT", "/update/20000", bytes.NewBuffer(jprod))
+	req, _ := http.NewRequest("PUT", "/products/20000", productBody(newprod))
 	resp := httptest.NewRecorder()
-	myRouter := mux.NewRouter().StrictSlash(true)
-	myRouter.HandleFunc("/update/{id}",ctrl.UpdateProd).Methods("PUT")
+	myRouter := NewRouter(ctrl)
 	myRouter.ServeHTTP(resp, req)
 
 	assert.Equal(t, 404, resp.Code, "Not Found is expected")
@@ -224,19 +228,15 @@ func TestUpdateFailureWithInvalidNewPrice(t *testing.T) {
 	mockDatastore := mocks.NewMockDatastore(mockCtrl)
 	ctrl := NewController(mockDatastore)
 	prod := &model.Product{}
-	query:="id = ?"
-	i:= strconv.Itoa(2)
-	mockDatastore.EXPECT().GetProductForUpdate(query,i,prod).Return(nil)
+	mockDatastore.EXPECT().GetProduct(2,prod).DoAndReturn(stored(model.Product{Id: 2, Name: "prod2", Price: 20, CategoryId: 1}))
 	newprod := &model.Product{
 		Name: "prod32",
 		Price: -55,
 		CategoryId: 2,
 	}
-	jprod, _ := json.Marshal(newprod)
-	req, _ := http.NewRequest("PUT", "/update/2", bytes.NewBuffer(jprod))
+	req, _ := http.NewRequest("PUT", "/products/2", productBody(newprod))
 	resp := httptest.NewRecorder()
-	myRouter := mux.NewRouter().StrictSlash(true)
-	myRouter.HandleFunc("/update/{id}",ctrl.UpdateProd).Methods("PUT")
+	myRouter := NewRouter(ctrl)
 	myRouter.ServeHTTP(resp, req)
 
 	assert.Equal(t, 400, resp.Code, "Bad Request is expected")
@@ -249,23 +249,20 @@ func TestUpdateFailureWithDuplicateNewName(t *testing.T) {
 	mockDatastore := mocks.NewMockDatastore(mockCtrl)
 	ctrl := NewController(mockDatastore)
 	prod := &model.Product{}
-	query:="id = ?"
-	i:= strconv.Itoa(2)
-	mockDatastore.EXPECT().GetProductForUpdate(query,i,prod).Return(nil)
+	mockDatastore.EXPECT().GetProduct(2,prod).DoAndReturn(stored(model.Product{Id: 2, Name: "prod2", Price: 20, CategoryId: 1}))
 	newprod := &model.Product{
+		Id: 2,
 		Name: "prod32",
 		Price: 55,
 		CategoryId: 2,
 	}
-	mockDatastore.EXPECT().Save(newprod).Return(errors.New("duplicate key value violates unique constraint"))
-	jprod, _ := json.Marshal(newprod)
-	req, _ := http.NewRequest("PUT", "/update/2", bytes.NewBuffer(jprod))
+	mockDatastore.EXPECT().Save(newprod).Return(datastore.ConflictError{Field: "name"})
+	req, _ := http.NewRequest("PUT", "/products/2", productBody(newprod))
 	resp := httptest.NewRecorder()
-	myRouter := mux.NewRouter().StrictSlash(true)
-	myRouter.HandleFunc("/update/{id}",ctrl.UpdateProd).Methods("PUT")
+	myRouter := NewRouter(ctrl)
 	myRouter.ServeHTTP(resp, req)
 
-	assert.Equal(t, 400, resp.Code, "Bad Request is expected")
+	assert.Equal(t, 409, resp.Code, "Conflict is expected")
 }
 func TestUpdateSuccess(t *testing.T) {
 
@@ -274,23 +271,23 @@ func TestUpdateSuccess(t *testing.T) {
 	mockDatastore := mocks.NewMockDatastore(mockCtrl)
 	ctrl := NewController(mockDatastore)
 	prod := &model.Product{}
-	query:="id = ?"
-	i:= strconv.Itoa(2)
-	mockDatastore.EXPECT().GetProductForUpdate(query,i,prod).Return(nil)
+	mockDatastore.EXPECT().GetProduct(2,prod).DoAndReturn(stored(model.Product{Id: 2, Name: "prod2", Price: 20, CategoryId: 1}))
 	newprod := &model.Product{
+		Id: 2,
 		Name: "prod32",
 		Price: 55,
 		CategoryId: 2,
 	}
 	mockDatastore.EXPECT().Save(newprod).Return(nil)
-	jprod, _ := json.Marshal(newprod)
-	req, _ := http.NewRequest("PUT", "/update/2", bytes.NewBuffer(jprod))
+	req, _ := http.NewRequest("PUT", "/products/2", productBody(newprod))
 	resp := httptest.NewRecorder()
-	myRouter := mux.NewRouter().StrictSlash(true)
-	myRouter.HandleFunc("/update/{id}",ctrl.UpdateProd).Methods("PUT")
+	myRouter := NewRouter(ctrl)
 	myRouter.ServeHTTP(resp, req)
 
-	assert.Equal(t, 201, resp.Code, "Updated successfully is expected")
+	assert.Equal(t, 200, resp.Code, "OK is expected")
+	body := ProductResponse{}
+	json.NewDecoder(resp.Body).Decode(&body)
+	assert.Equal(t, newProductResponse(*newprod), body, "updated product is expected")
 }
 
 func TestGetFailureWithWrongCatgoryId(t *testing.T) {
@@ -299,14 +296,13 @@ func TestGetFailureWithWrongCatgoryId(t *testing.T) {
 	defer mockCtrl.Finish()
 	mockDatastore := mocks.NewMockDatastore(mockCtrl)
 	ctrl := NewController(mockDatastore)
-	req, _ := http.NewRequest("GET", "/get", nil)
+	req, _ := http.NewRequest("GET", "/products", nil)
 	q := req.URL.Query()
 	q.Add("categoryId", "30")
 	req.URL.RawQuery = q.Encode()
-	mockDatastore.EXPECT().GetCategorisedProducts(q).Return([]model.Product{})
+	mockDatastore.EXPECT().CategoryExists(30).Return(false, nil)
 	resp := httptest.NewRecorder()
-	myRouter := mux.NewRouter().StrictSlash(true)
-	myRouter.HandleFunc("/get",ctrl.ListProd).Methods("GET")
+	myRouter := NewRouter(ctrl)
 	myRouter.ServeHTTP(resp, req)
 
 	assert.Equal(t, 404, resp.Code, "Not Found is expected")
@@ -318,12 +314,10 @@ func TestGetSuccessWithNoValues(t *testing.T) {
 	defer mockCtrl.Finish()
 	mockDatastore := mocks.NewMockDatastore(mockCtrl)
 	ctrl := NewController(mockDatastore)
-	req, _ := http.NewRequest("GET", "/get", nil)
-	q := req.URL.Query()
-	mockDatastore.EXPECT().GetCategorisedProducts(q).Return([]model.Product{{3, "prod120", 100, time.Time{}, 3}})
+	req, _ := http.NewRequest("GET", "/products", nil)
+	mockDatastore.EXPECT().GetCategorisedProducts(model.ProductQuery{Limit: 21}).Return([]model.Product{{Id: 3, Name: "prod120", Price: 100, Expiry: time.Time{}, CategoryId: 3}}, nil)
 	resp := httptest.NewRecorder()
-	myRouter := mux.NewRouter().StrictSlash(true)
-	myRouter.HandleFunc("/get",ctrl.ListProd).Methods("GET")
+	myRouter := NewRouter(ctrl)
 	myRouter.ServeHTTP(resp, req)
 
 	assert.Equal(t, 200, resp.Code, "OK is expected")
@@ -336,14 +330,14 @@ func TestGetSuccessWithIdOnly(t *testing.T) {
 	defer mockCtrl.Finish()
 	mockDatastore := mocks.NewMockDatastore(mockCtrl)
 	ctrl := NewController(mockDatastore)
-	req, _ := http.NewRequest("GET", "/get", nil)
+	req, _ := http.NewRequest("GET", "/products", nil)
 	q := req.URL.Query()
 	q.Add("categoryId", "3")
 	req.URL.RawQuery = q.Encode()
-	mockDatastore.EXPECT().GetCategorisedProducts(q).Return([]model.Product{{3, "prod120", 100, time.Time{}, 3}})
+	mockDatastore.EXPECT().CategoryExists(3).Return(true, nil)
+	mockDatastore.EXPECT().GetCategorisedProducts(model.ProductQuery{Filters: []model.Filter{{Field: "categoryId", Op: model.OpEq, Values: []interface{}{3}}}, Limit: 21}).Return([]model.Product{{Id: 3, Name: "prod120", Price: 100, Expiry: time.Time{}, CategoryId: 3}}, nil)
 	resp := httptest.NewRecorder()
-	myRouter := mux.NewRouter().StrictSlash(true)
-	myRouter.HandleFunc("/get",ctrl.ListProd).Methods("GET")
+	myRouter := NewRouter(ctrl)
 	myRouter.ServeHTTP(resp, req)
 
 	assert.Equal(t, 200, resp.Code, "OK is expected")
@@ -355,14 +349,13 @@ func TestGetSuccessWithSortOnly(t *testing.T) {
 	defer mockCtrl.Finish()
 	mockDatastore := mocks.NewMockDatastore(mockCtrl)
 	ctrl := NewController(mockDatastore)
-	req, _ := http.NewRequest("GET", "/get", nil)
+	req, _ := http.NewRequest("GET", "/products", nil)
 	q := req.URL.Query()
 	q.Add("sort", "price")
 	req.URL.RawQuery = q.Encode()
-	mockDatastore.EXPECT().GetCategorisedProducts(q).Return([]model.Product{{3, "prod120", 100, time.Time{}, 3}})
+	mockDatastore.EXPECT().GetCategorisedProducts(model.ProductQuery{Sort: []model.SortKey{{Field: "price"}}, Limit: 21}).Return([]model.Product{{Id: 3, Name: "prod120", Price: 100, Expiry: time.Time{}, CategoryId: 3}}, nil)
 	resp := httptest.NewRecorder()
-	myRouter := mux.NewRouter().StrictSlash(true)
-	myRouter.HandleFunc("/get",ctrl.ListProd).Methods("GET")
+	myRouter := NewRouter(ctrl)
 	myRouter.ServeHTTP(resp, req)
 
 	assert.Equal(t, 200, resp.Code, "OK is expected")
@@ -374,15 +367,14 @@ func TestGetSuccessWithSortAndOrder(t *testing.T) {
 	defer mockCtrl.Finish()
 	mockDatastore := mocks.NewMockDatastore(mockCtrl)
 	ctrl := NewController(mockDatastore)
-	req, _ := http.NewRequest("GET", "/get", nil)
+	req, _ := http.NewRequest("GET", "/products", nil)
 	q := req.URL.Query()
 	q.Add("sort", "price")
 	q.Add("order", "desc")
 	req.URL.RawQuery = q.Encode()
-	mockDatastore.EXPECT().GetCategorisedProducts(q).Return([]model.Product{{3, "prod120", 100, time.Time{}, 3}})
+	mockDatastore.EXPECT().GetCategorisedProducts(model.ProductQuery{Sort: []model.SortKey{{Field: "price", Desc: true}}, Limit: 21}).Return([]model.Product{{Id: 3, Name: "prod120", Price: 100, Expiry: time.Time{}, CategoryId: 3}}, nil)
 	resp := httptest.NewRecorder()
-	myRouter := mux.NewRouter().StrictSlash(true)
-	myRouter.HandleFunc("/get",ctrl.ListProd).Methods("GET")
+	myRouter := NewRouter(ctrl)
 	myRouter.ServeHTTP(resp, req)
 
 	assert.Equal(t, 200, resp.Code, "OK is expected")
@@ -394,15 +386,15 @@ func TestGetSuccessWithIdAndSort(t *testing.T) {
 	defer mockCtrl.Finish()
 	mockDatastore := mocks.NewMockDatastore(mockCtrl)
 	ctrl := NewController(mockDatastore)
-	req, _ := http.NewRequest("GET", "/get", nil)
+	req, _ := http.NewRequest("GET", "/products", nil)
 	q := req.URL.Query()
 	q.Add("sort", "price")
 	q.Add("categoryId", "3")
 	req.URL.RawQuery = q.Encode()
-	mockDatastore.EXPECT().GetCategorisedProducts(q).Return([]model.Product{{3, "prod120", 100, time.Time{}, 3}})
+	mockDatastore.EXPECT().CategoryExists(3).Return(true, nil)
+	mockDatastore.EXPECT().GetCategorisedProducts(model.ProductQuery{Filters: []model.Filter{{Field: "categoryId", Op: model.OpEq, Values: []interface{}{3}}}, Sort: []model.SortKey{{Field: "price"}}, Limit: 21}).Return([]model.Product{{Id: 3, Name: "prod120", Price: 100, Expiry: time.Time{}, CategoryId: 3}}, nil)
 	resp := httptest.NewRecorder()
-	myRouter := mux.NewRouter().StrictSlash(true)
-	myRouter.HandleFunc("/get",ctrl.ListProd).Methods("GET")
+	myRouter := NewRouter(ctrl)
 	myRouter.ServeHTTP(resp, req)
 
 	assert.Equal(t, 200, resp.Code, "OK is expected")
@@ -414,21 +406,1982 @@ func TestGetSuccessWithAllValues(t *testing.T) {
 	defer mockCtrl.Finish()
 	mockDatastore := mocks.NewMockDatastore(mockCtrl)
 	ctrl := NewController(mockDatastore)
-	req, _ := http.NewRequest("GET", "/get", nil)
+	req, _ := http.NewRequest("GET", "/products", nil)
 	q := req.URL.Query()
 	q.Add("categoryId", "3")
 	q.Add("sort", "price")
 	q.Add("order", "desc")
 	req.URL.RawQuery = q.Encode()
-	mockDatastore.EXPECT().GetCategorisedProducts(q).Return([]model.Product{{3, "prod120", 100, time.Time{}, 3}})
+	mockDatastore.EXPECT().CategoryExists(3).Return(true, nil)
+	mockDatastore.EXPECT().GetCategorisedProducts(model.ProductQuery{Filters: []model.Filter{{Field: "categoryId", Op: model.OpEq, Values: []interface{}{3}}}, Sort: []model.SortKey{{Field: "price", Desc: true}}, Limit: 21}).Return([]model.Product{{Id: 3, Name: "prod120", Price: 100, Expiry: time.Time{}, CategoryId: 3}}, nil)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "OK is expected")
+}
+
+
+
+
+func TestGetOneSuccess(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	mockDatastore.EXPECT().GetProduct(3, &model.Product{}).DoAndReturn(func(id int, prod *model.Product) error {
+		*prod = model.Product{Id: 3, Name: "prod120", Price: 100, CategoryId: 3}
+		return nil
+	})
+	req, _ := http.NewRequest("GET", "/products/3", nil)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "OK is expected")
+	body := map[string]interface{}{}
+	json.NewDecoder(resp.Body).Decode(&body)
+	assert.Equal(t, float64(3), body["id"], "declared json field names are expected")
+	assert.Equal(t, "prod120", body["name"], "declared json field names are expected")
+	assert.Equal(t, float64(3), body["categoryId"], "declared json field names are expected")
+}
+
+func TestGetOneFailureWithInvalidId(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	mockDatastore.EXPECT().GetProduct(20000, &model.Product{}).Return(datastore.ErrNotFound)
+	req, _ := http.NewRequest("GET", "/products/20000", nil)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 404, resp.Code, "Not Found is expected")
+}
+
+func TestGetOneFailureWithNonNumericId(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	req, _ := http.NewRequest("GET", "/products/abc", nil)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 404, resp.Code, "Not Found is expected")
+}
+
+func TestDeprecatedAliasStillServed(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	mockDatastore.EXPECT().GetProduct(2,&model.Product{}).DoAndReturn(stored(model.Product{Id: 2, Name: "prod2", Price: 20, CategoryId: 1, Version: 1}))
+	mockDatastore.EXPECT().Delete(&model.Product{Id: 2, Name: "prod2", Price: 20, CategoryId: 1, Version: 1}).Return(nil)
+	req, _ := http.NewRequest("DELETE", "/delete/2",nil)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "deleted successfully is expexted")
+	assert.Equal(t, "true", resp.Header().Get("Deprecation"), "Deprecation header is expected")
+	assert.Equal(t, "</products/2>; rel=\"successor-version\"", resp.Header().Get("Link"), "successor link is expected")
+}
+
+func TestNewPathIsNotDeprecated(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	mockDatastore.EXPECT().GetProduct(2,&model.Product{}).DoAndReturn(stored(model.Product{Id: 2, Name: "prod2", Price: 20, CategoryId: 1, Version: 1}))
+	mockDatastore.EXPECT().Delete(&model.Product{Id: 2, Name: "prod2", Price: 20, CategoryId: 1, Version: 1}).Return(nil)
+	req, _ := http.NewRequest("DELETE", "/products/2",nil)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, "", resp.Header().Get("Deprecation"), "no Deprecation header is expected")
+}
+
+func TestWrongMethodOnCollection(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	req, _ := http.NewRequest("DELETE", "/products",nil)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 405, resp.Code, "Method Not Allowed is expected")
+	assert.Equal(t, "GET, POST", resp.Header().Get("Allow"), "Allow header is expected")
+}
+
+func TestWrongMethodOnItem(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	req, _ := http.NewRequest("POST", "/products/2",nil)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 405, resp.Code, "Method Not Allowed is expected")
+	assert.Equal(t, "GET, PUT, PATCH, DELETE", resp.Header().Get("Allow"), "Allow header is expected")
+}
+
+func TestCreateFailureWithUnavailableDatastore(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	prod := &model.Product{
+		Name: "prod100",
+		Price: 34,
+		CategoryId: 1,
+	}
+	mockDatastore.EXPECT().Create(prod).Return(fmt.Errorf("%w: connection refused", datastore.ErrUnavailable))
+	req, _ := http.NewRequest("POST", "/products", productBody(prod))
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 503, resp.Code, "Service Unavailable is expected")
+}
+
+func TestCreateFailureWithInvalidRecord(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	prod := &model.Product{
+		Name: "prod100",
+		Price: 34,
+		CategoryId: 1,
+	}
+	mockDatastore.EXPECT().Create(prod).Return(fmt.Errorf("%w: value too long", datastore.ErrInvalid))
+	req, _ := http.NewRequest("POST", "/products", productBody(prod))
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 422, resp.Code, "Unprocessable Entity is expected")
+}
+
+func TestCreateFailureWithUnknownError(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	prod := &model.Product{
+		Name: "prod100",
+		Price: 34,
+		CategoryId: 1,
+	}
+	mockDatastore.EXPECT().Create(prod).Return(errors.New("something broke"))
+	req, _ := http.NewRequest("POST", "/products", productBody(prod))
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 500, resp.Code, "Internal Server Error is expected")
+	assert.NotContains(t, resp.Body.String(), "something broke", "internal errors are not leaked")
+}
+
+func TestGetFailureWithUnavailableDatastore(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	req, _ := http.NewRequest("GET", "/products", nil)
+	mockDatastore.EXPECT().GetCategorisedProducts(model.ProductQuery{Limit: 21}).Return(nil, datastore.ErrUnavailable)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 503, resp.Code, "Service Unavailable is expected")
+}
+
+func TestCreateFailureReportsEveryField(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	req, _ := http.NewRequest("POST", "/products", productBody(&model.Product{}))
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 400, resp.Code, "Bad Request is expected")
+	assert.Equal(t, "application/problem+json", resp.Header().Get("Content-Type"), "problem+json is expected")
+	problem := Problem{}
+	json.NewDecoder(resp.Body).Decode(&problem)
+	assert.Equal(t, validationProblem, problem.Type, "validation problem type is expected")
+	assert.Equal(t, 400, problem.Status, "status is expected in the body")
+	assert.Equal(t, "/products", problem.Instance, "instance is expected")
+	assert.Equal(t, []FieldError{
+		{Field: "name", Detail: "name is missing"},
+		{Field: "price", Detail: "price is missing or invalid"},
+		{Field: "categoryId", Detail: "category is missing"},
+	}, problem.Errors, "every field violation is expected")
+}
+
+func TestCreateFailureWithMalformedBody(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	req, _ := http.NewRequest("POST", "/products", bytes.NewBufferString("{name"))
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 400, resp.Code, "Bad Request is expected")
+	assert.Equal(t, "application/problem+json", resp.Header().Get("Content-Type"), "problem+json is expected")
+}
+
+func TestConflictProblemNamesField(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	prod := &model.Product{
+		Name: "prod1",
+		Price: 34,
+		CategoryId: 1,
+	}
+	mockDatastore.EXPECT().Create(prod).Return(datastore.ConflictError{Field: "name"})
+	req, _ := http.NewRequest("POST", "/products", productBody(prod))
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	problem := Problem{}
+	json.NewDecoder(resp.Body).Decode(&problem)
+	assert.Equal(t, "Conflict", problem.Title, "status text title is expected")
+	assert.Equal(t, []FieldError{{Field: "name", Detail: "name already exists"}}, problem.Errors, "conflicting field is expected")
+}
+
+func TestDeleteSuccessIsNotAnError(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	mockDatastore.EXPECT().GetProduct(2,&model.Product{}).DoAndReturn(stored(model.Product{Id: 2, Name: "prod2", Price: 20, CategoryId: 1, Version: 1}))
+	mockDatastore.EXPECT().Delete(&model.Product{Id: 2, Name: "prod2", Price: 20, CategoryId: 1, Version: 1}).Return(nil)
+	req, _ := http.NewRequest("DELETE", "/products/2",nil)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	body := map[string]string{}
+	json.NewDecoder(resp.Body).Decode(&body)
+	assert.Equal(t, map[string]string{"message": "deleted successfully"}, body, "success message is expected")
+}
+
+func TestCreateWithExpiry(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	expiry := time.Date(2026, 12, 1, 10, 0, 0, 0, time.FixedZone("", 2*60*60))
+	mockDatastore.EXPECT().Create(gomock.Any()).DoAndReturn(func(prod *model.Product) error {
+		assert.True(t, expiry.Equal(prod.Expiry), "parsed expiry is expected")
+		prod.Id = 7
+		return nil
+	})
+	req, _ := http.NewRequest("POST", "/products", bytes.NewBufferString(`{"name":"milk","price":2.5,"expiry":"2026-12-01T10:00:00+02:00","categoryId":1}`))
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 201, resp.Code, "Created successfully is expected")
+	body := map[string]interface{}{}
+	json.NewDecoder(resp.Body).Decode(&body)
+	assert.Equal(t, "2026-12-01T08:00:00Z", body["expiry"], "RFC 3339 expiry is expected")
+	assert.Equal(t, float64(1), body["categoryId"], "camelCase field names are expected")
+}
+
+func TestCreateFailureWithMalformedExpiry(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	req, _ := http.NewRequest("POST", "/products", bytes.NewBufferString(`{"name":"milk","price":2.5,"expiry":"01/12/2026","categoryId":1}`))
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 400, resp.Code, "Bad Request is expected")
+	problem := Problem{}
+	json.NewDecoder(resp.Body).Decode(&problem)
+	assert.Equal(t, []FieldError{{Field: "expiry", Detail: "expiry must be an RFC 3339 timestamp"}}, problem.Errors, "expiry violation is expected")
+}
+
+func TestUpdateIgnoresIdInBody(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	mockDatastore.EXPECT().GetProduct(2,&model.Product{}).DoAndReturn(stored(model.Product{Id: 2, Name: "prod2", Price: 20, CategoryId: 1}))
+	mockDatastore.EXPECT().Save(&model.Product{Id: 2, Name: "prod32", Price: 55, CategoryId: 2}).Return(nil)
+	req, _ := http.NewRequest("PUT", "/products/2", bytes.NewBufferString(`{"id":9,"name":"prod32","price":55,"categoryId":2}`))
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "OK is expected")
+}
+
+func TestUpdateFailureWithMissingFields(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	mockDatastore.EXPECT().GetProduct(2,&model.Product{}).DoAndReturn(stored(model.Product{Id: 2, Name: "prod2", Price: 20, CategoryId: 1}))
+	req, _ := http.NewRequest("PUT", "/products/2", bytes.NewBufferString(`{"price":55}`))
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 400, resp.Code, "Bad Request is expected")
+}
+
+func TestPatchWithMergePatch(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	mockDatastore.EXPECT().GetProduct(2,&model.Product{}).DoAndReturn(stored(model.Product{Id: 2, Name: "prod2", Price: 20, CategoryId: 1}))
+	mockDatastore.EXPECT().Update(&model.Product{Id: 2, Name: "prod2", Price: 25, CategoryId: 1}, map[string]interface{}{"Price": float32(25)}).Return(nil)
+	req, _ := http.NewRequest("PATCH", "/products/2", bytes.NewBufferString(`{"price":25}`))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
 	resp := httptest.NewRecorder()
-	myRouter := mux.NewRouter().StrictSlash(true)
-	myRouter.HandleFunc("/get",ctrl.ListProd).Methods("GET")
+	myRouter := NewRouter(ctrl)
 	myRouter.ServeHTTP(resp, req)
 
 	assert.Equal(t, 200, resp.Code, "OK is expected")
+	body := ProductResponse{}
+	json.NewDecoder(resp.Body).Decode(&body)
+	assert.Equal(t, ProductResponse{Id: 2, Name: "prod2", Price: 25, CategoryId: 1}, body, "patched product is expected")
 }
 
+func TestPatchWithJSONPatch(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	mockDatastore.EXPECT().GetProduct(2,&model.Product{}).DoAndReturn(stored(model.Product{Id: 2, Name: "prod2", Price: 20, CategoryId: 1}))
+	expiry := time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC)
+	mockDatastore.EXPECT().Update(&model.Product{Id: 2, Name: "cheese", Price: 20, Expiry: expiry, CategoryId: 1}, map[string]interface{}{"Name": "cheese", "Expiry": expiry}).Return(nil)
+	req, _ := http.NewRequest("PATCH", "/products/2", bytes.NewBufferString(`[
+		{"op":"test","path":"/name","value":"prod2"},
+		{"op":"replace","path":"/name","value":"cheese"},
+		{"op":"add","path":"/expiry","value":"2026-12-01T00:00:00Z"}
+	]`))
+	req.Header.Set("Content-Type", "application/json-patch+json")
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
 
+	assert.Equal(t, 200, resp.Code, "OK is expected")
+}
 
+func TestPatchWithoutChangesDoesNotWrite(t *testing.T) {
 
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	mockDatastore.EXPECT().GetProduct(2,&model.Product{}).DoAndReturn(stored(model.Product{Id: 2, Name: "prod2", Price: 20, CategoryId: 1}))
+	req, _ := http.NewRequest("PATCH", "/products/2", bytes.NewBufferString(`{"price":20}`))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "OK is expected")
+}
+
+func TestPatchKeepsSubSecondExpiry(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	expiry := time.Date(2026, 12, 1, 10, 0, 0, 500000000, time.UTC)
+	mockDatastore.EXPECT().GetProduct(2,&model.Product{}).DoAndReturn(stored(model.Product{Id: 2, Name: "prod2", Price: 20, Expiry: expiry, CategoryId: 1}))
+	mockDatastore.EXPECT().Update(gomock.Any(), map[string]interface{}{"Name": "b"}).Return(nil)
+	req, _ := http.NewRequest("PATCH", "/products/2", bytes.NewBufferString(`{"name":"b"}`))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "OK is expected")
+	body := ProductResponse{}
+	json.NewDecoder(resp.Body).Decode(&body)
+	assert.Equal(t, "2026-12-01T10:00:00.5Z", body.Expiry, "the fraction of a second is expected to be kept")
+}
+
+func TestPatchFailureWithUnsupportedMediaType(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	req, _ := http.NewRequest("PATCH", "/products/2", bytes.NewBufferString(`{"price":20}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 415, resp.Code, "Unsupported Media Type is expected")
+	assert.Equal(t, "application/merge-patch+json, application/json-patch+json", resp.Header().Get("Accept-Patch"), "Accept-Patch is expected")
+}
+
+func TestPatchFailureRevalidatesResult(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	mockDatastore.EXPECT().GetProduct(2,&model.Product{}).DoAndReturn(stored(model.Product{Id: 2, Name: "prod2", Price: 20, CategoryId: 1}))
+	req, _ := http.NewRequest("PATCH", "/products/2", bytes.NewBufferString(`{"name":null,"categoryId":0}`))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 400, resp.Code, "Bad Request is expected")
+	problem := Problem{}
+	json.NewDecoder(resp.Body).Decode(&problem)
+	assert.Equal(t, []FieldError{
+		{Field: "name", Detail: "name is missing"},
+		{Field: "categoryId", Detail: "category is missing"},
+	}, problem.Errors, "every field violation is expected")
+}
+
+func TestPatchFailureWithFailedTest(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	mockDatastore.EXPECT().GetProduct(2,&model.Product{}).DoAndReturn(stored(model.Product{Id: 2, Name: "prod2", Price: 20, CategoryId: 1}))
+	req, _ := http.NewRequest("PATCH", "/products/2", bytes.NewBufferString(`[{"op":"test","path":"/price","value":21},{"op":"replace","path":"/price","value":30}]`))
+	req.Header.Set("Content-Type", "application/json-patch+json")
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 409, resp.Code, "Conflict is expected")
+}
+
+func TestPatchFailureWithMissingPath(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	mockDatastore.EXPECT().GetProduct(2,&model.Product{}).DoAndReturn(stored(model.Product{Id: 2, Name: "prod2", Price: 20, CategoryId: 1}))
+	req, _ := http.NewRequest("PATCH", "/products/2", bytes.NewBufferString(`[{"op":"remove","path":"/colour"}]`))
+	req.Header.Set("Content-Type", "application/json-patch+json")
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 422, resp.Code, "Unprocessable Entity is expected")
+}
+
+func TestPatchFailureChangingId(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	mockDatastore.EXPECT().GetProduct(2,&model.Product{}).DoAndReturn(stored(model.Product{Id: 2, Name: "prod2", Price: 20, CategoryId: 1}))
+	req, _ := http.NewRequest("PATCH", "/products/2", bytes.NewBufferString(`{"id":3}`))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 400, resp.Code, "Bad Request is expected")
+}
+
+func TestJSONPatchOperations(t *testing.T) {
+
+	var doc interface{}
+	json.Unmarshal([]byte(`{"a":{"b":[1,2,3]},"c~d":"x"}`), &doc)
+	ops := []patchOp{}
+	json.Unmarshal([]byte(`[
+		{"op":"add","path":"/a/b/1","value":9},
+		{"op":"remove","path":"/a/b/0"},
+		{"op":"copy","from":"/c~0d","path":"/e"},
+		{"op":"move","from":"/a/b/-1","path":"/f"}
+	]`), &ops)
+	_, err := jsonPatch(doc, ops)
+	assert.NotNil(t, err, "- is not a valid index to read from")
+
+	json.Unmarshal([]byte(`{"a":{"b":[1,2,3]},"c~d":"x"}`), &doc)
+	json.Unmarshal([]byte(`[
+		{"op":"add","path":"/a/b/1","value":9},
+		{"op":"remove","path":"/a/b/0"},
+		{"op":"copy","from":"/c~0d","path":"/e"},
+		{"op":"move","from":"/a/b/2","path":"/a/b/-"},
+		{"op":"add","path":"/a~1z","value":null}
+	]`), &ops)
+	result, err := jsonPatch(doc, ops)
+	assert.Nil(t, err, "patch is expected to apply")
+	want := map[string]interface{}{}
+	json.Unmarshal([]byte(`{"a":{"b":[9,2,3]},"c~d":"x","e":"x","a/z":null}`), &want)
+	assert.Equal(t, want, result, "patched document is expected")
+}
+
+func TestGetOneSendsETag(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	mockDatastore.EXPECT().GetProduct(2,&model.Product{}).DoAndReturn(stored(model.Product{Id: 2, Name: "prod2", Price: 20, CategoryId: 1, Version: 4}))
+	req, _ := http.NewRequest("GET", "/products/2", nil)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, `"4"`, resp.Header().Get("ETag"), "version ETag is expected")
+}
+
+func TestUpdateFailureWithStaleIfMatch(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	mockDatastore.EXPECT().GetProduct(2,&model.Product{}).DoAndReturn(stored(model.Product{Id: 2, Name: "prod2", Price: 20, CategoryId: 1, Version: 4}))
+	req, _ := http.NewRequest("PUT", "/products/2", productBody(&model.Product{Name: "prod32", Price: 55, CategoryId: 2}))
+	req.Header.Set("If-Match", `"3"`)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 412, resp.Code, "Precondition Failed is expected")
+}
+
+func TestUpdateSuccessWithIfMatch(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	mockDatastore.EXPECT().GetProduct(2,&model.Product{}).DoAndReturn(stored(model.Product{Id: 2, Name: "prod2", Price: 20, CategoryId: 1, Version: 4}))
+	mockDatastore.EXPECT().Save(&model.Product{Id: 2, Name: "prod32", Price: 55, CategoryId: 2, Version: 4}).DoAndReturn(func(prod *model.Product) error {
+		prod.Version++
+		return nil
+	})
+	req, _ := http.NewRequest("PUT", "/products/2", productBody(&model.Product{Name: "prod32", Price: 55, CategoryId: 2}))
+	req.Header.Set("If-Match", `"4"`)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "OK is expected")
+	assert.Equal(t, `"5"`, resp.Header().Get("ETag"), "new version ETag is expected")
+}
+
+func TestUpdateFailureWithConcurrentWrite(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	mockDatastore.EXPECT().GetProduct(2,&model.Product{}).DoAndReturn(stored(model.Product{Id: 2, Name: "prod2", Price: 20, CategoryId: 1, Version: 4}))
+	mockDatastore.EXPECT().Save(gomock.Any()).Return(datastore.ErrStale) // someone else wrote between our read and write
+	req, _ := http.NewRequest("PUT", "/products/2", productBody(&model.Product{Name: "prod32", Price: 55, CategoryId: 2}))
+	req.Header.Set("If-Match", `"4"`)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 412, resp.Code, "Precondition Failed is expected")
+}
+
+func TestPatchFailureWithStaleIfMatch(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	mockDatastore.EXPECT().GetProduct(2,&model.Product{}).DoAndReturn(stored(model.Product{Id: 2, Name: "prod2", Price: 20, CategoryId: 1, Version: 4}))
+	req, _ := http.NewRequest("PATCH", "/products/2", bytes.NewBufferString(`{"price":25}`))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	req.Header.Set("If-Match", `"1", "2"`)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 412, resp.Code, "Precondition Failed is expected")
+}
+
+func TestDeleteFailureWithStaleIfMatch(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	mockDatastore.EXPECT().GetProduct(2,&model.Product{}).DoAndReturn(stored(model.Product{Id: 2, Name: "prod2", Price: 20, CategoryId: 1, Version: 4}))
+	req, _ := http.NewRequest("DELETE", "/products/2", nil)
+	req.Header.Set("If-Match", `"3"`)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 412, resp.Code, "Precondition Failed is expected")
+}
+
+func TestDeleteSuccessWithWildcardIfMatch(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	mockDatastore.EXPECT().GetProduct(2,&model.Product{}).DoAndReturn(stored(model.Product{Id: 2, Name: "prod2", Price: 20, CategoryId: 1, Version: 4}))
+	mockDatastore.EXPECT().Delete(&model.Product{Id: 2, Name: "prod2", Price: 20, CategoryId: 1, Version: 4}).Return(nil)
+	req, _ := http.NewRequest("DELETE", "/products/2", nil)
+	req.Header.Set("If-Match", "*")
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "OK is expected")
+}
+
+func TestGetOneNotModifiedWithIfNoneMatch(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore, WithCacheControl("max-age=60"))
+	updated := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	mockDatastore.EXPECT().GetProduct(2,&model.Product{}).DoAndReturn(stored(model.Product{Id: 2, Name: "prod2", Price: 20, CategoryId: 1, Version: 4, UpdatedAt: updated}))
+	req, _ := http.NewRequest("GET", "/products/2", nil)
+	req.Header.Set("If-None-Match", `W/"4"`)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 304, resp.Code, "Not Modified is expected")
+	assert.Equal(t, 0, resp.Body.Len(), "no body is expected")
+	assert.Equal(t, "max-age=60", resp.Header().Get("Cache-Control"), "configured Cache-Control is expected")
+	assert.Equal(t, "Thu, 01 Oct 2026 12:00:00 GMT", resp.Header().Get("Last-Modified"), "Last-Modified is expected")
+}
+
+func TestGetOneModifiedSince(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	updated := time.Date(2026, 10, 1, 12, 0, 0, 500, time.UTC)
+	mockDatastore.EXPECT().GetProduct(2,&model.Product{}).DoAndReturn(stored(model.Product{Id: 2, Name: "prod2", Price: 20, CategoryId: 1, Version: 4, UpdatedAt: updated})).Times(2)
+	myRouter := NewRouter(ctrl)
+
+	req, _ := http.NewRequest("GET", "/products/2", nil)
+	req.Header.Set("If-Modified-Since", "Thu, 01 Oct 2026 12:00:00 GMT")
+	resp := httptest.NewRecorder()
+	myRouter.ServeHTTP(resp, req)
+	assert.Equal(t, 304, resp.Code, "Not Modified is expected")
+	assert.Equal(t, "no-cache", resp.Header().Get("Cache-Control"), "default Cache-Control is expected")
+
+	req, _ = http.NewRequest("GET", "/products/2", nil)
+	req.Header.Set("If-Modified-Since", "Thu, 01 Oct 2026 11:59:59 GMT")
+	resp = httptest.NewRecorder()
+	myRouter.ServeHTTP(resp, req)
+	assert.Equal(t, 200, resp.Code, "OK is expected")
+}
+
+func TestListNotModifiedWithIfNoneMatch(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	req, _ := http.NewRequest("GET", "/products", nil)
+	mockDatastore.EXPECT().GetCategorisedProducts(model.ProductQuery{Limit: 21}).Return([]model.Product{{Id: 3, Name: "prod120", Price: 100, CategoryId: 3}}, nil).Times(2)
+	myRouter := NewRouter(ctrl)
+
+	resp := httptest.NewRecorder()
+	myRouter.ServeHTTP(resp, req)
+	assert.Equal(t, 200, resp.Code, "OK is expected")
+	etag := resp.Header().Get("ETag")
+	assert.NotEqual(t, "", etag, "ETag is expected")
+
+	req.Header.Set("If-None-Match", etag)
+	resp = httptest.NewRecorder()
+	myRouter.ServeHTTP(resp, req)
+	assert.Equal(t, 304, resp.Code, "Not Modified is expected")
+}
+
+func TestListIgnoresIfModifiedSince(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	updated := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	mockDatastore.EXPECT().GetCategorisedProducts(model.ProductQuery{Limit: 21}).Return([]model.Product{{Id: 3, Name: "prod120", Price: 100, CategoryId: 3, UpdatedAt: updated}}, nil)
+	req, _ := http.NewRequest("GET", "/products", nil)
+	req.Header.Set("If-Modified-Since", "Thu, 01 Oct 2026 12:00:00 GMT")
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "OK is expected, a row that left the list does not change the newest update")
+	assert.Equal(t, "", resp.Header().Get("Last-Modified"), "no Last-Modified is expected on a listing")
+}
+
+// products builds n listed products with ids from, from+1, ...
+func products(from, n int) []model.Product {
+	prod := make([]model.Product, n)
+	for i := range prod {
+		prod[i] = model.Product{Id: from + i, Name: "prod" + fmt.Sprint(from+i), Price: float32(from + i), CategoryId: 1}
+	}
+	return prod
+}
+
+func TestListWithOffsetPaging(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	mockDatastore.EXPECT().GetCategorisedProducts(model.ProductQuery{Limit: 3, Offset: 4}).Return(products(5, 3), nil)
+	req, _ := http.NewRequest("GET", "/products?limit=2&offset=4", nil)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "OK is expected")
+	body := []ProductResponse{}
+	json.NewDecoder(resp.Body).Decode(&body)
+	assert.Equal(t, 2, len(body), "one page is expected")
+	assert.Equal(t, `</products?limit=2&offset=6>; rel="next", </products?limit=2&offset=2>; rel="prev"`, resp.Header().Get("Link"), "offset links are expected")
+}
+
+func TestListLastOffsetPage(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	mockDatastore.EXPECT().GetCategorisedProducts(model.ProductQuery{Limit: 3, Offset: 1}).Return(products(2, 1), nil)
+	req, _ := http.NewRequest("GET", "/products?limit=2&offset=1", nil)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, `</products?limit=2&offset=0>; rel="prev"`, resp.Header().Get("Link"), "only a prev link is expected")
+}
+
+func TestListWithCursorPaging(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	sort := []model.SortKey{{Field: "price"}}
+	first := mockDatastore.EXPECT().GetCategorisedProducts(model.ProductQuery{Sort: sort, Limit: 3}).Return(products(1, 3), nil)
+	mockDatastore.EXPECT().GetCategorisedProducts(model.ProductQuery{Sort: sort, Limit: 3, After: []string{"2", "2"}}).Return(products(3, 2), nil).After(first)
+	mockDatastore.EXPECT().GetCategorisedProducts(model.ProductQuery{Sort: sort, Limit: 3, Before: []string{"3", "3"}}).Return(products(1, 2), nil)
+	myRouter := NewRouter(ctrl)
+
+	req, _ := http.NewRequest("GET", "/products?sort=price&limit=2", nil)
+	resp := httptest.NewRecorder()
+	myRouter.ServeHTTP(resp, req)
+	links := resp.Header().Get("Link")
+	assert.NotContains(t, links, `rel="prev"`, "no prev link is expected on the first page")
+	next := links[1:strings.Index(links, ">")]
+
+	req, _ = http.NewRequest("GET", next, nil)
+	resp = httptest.NewRecorder()
+	myRouter.ServeHTTP(resp, req)
+	assert.Equal(t, 200, resp.Code, "OK is expected")
+	links = resp.Header().Get("Link")
+	assert.NotContains(t, links, `rel="next"`, "no next link is expected on the last page")
+	prev := links[1:strings.Index(links, ">")]
+
+	req, _ = http.NewRequest("GET", prev, nil)
+	resp = httptest.NewRecorder()
+	myRouter.ServeHTTP(resp, req)
+	assert.Equal(t, 200, resp.Code, "OK is expected")
+	links = resp.Header().Get("Link")
+	assert.Contains(t, links, `rel="next"`, "next link is expected going back")
+	assert.NotContains(t, links, `rel="prev"`, "no prev link is expected back on the first page")
+}
+
+func TestListCursorKeepsInexactPrice(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	sort := []model.SortKey{{Field: "price"}}
+	page := []model.Product{{Id: 1, Name: "prod1", Price: 9.5}, {Id: 2, Name: "prod2", Price: 12.3}, {Id: 3, Name: "prod3", Price: 14}}
+	first := mockDatastore.EXPECT().GetCategorisedProducts(model.ProductQuery{Sort: sort, Limit: 3}).Return(page, nil)
+	mockDatastore.EXPECT().GetCategorisedProducts(model.ProductQuery{Sort: sort, Limit: 3, After: []string{"12.300000190734863", "2"}}).Return(page[2:], nil).After(first)
+	myRouter := NewRouter(ctrl)
+
+	req, _ := http.NewRequest("GET", "/products?sort=price&limit=2", nil)
+	resp := httptest.NewRecorder()
+	myRouter.ServeHTTP(resp, req)
+	links := resp.Header().Get("Link")
+	next := links[1:strings.Index(links, ">")]
+
+	req, _ = http.NewRequest("GET", next, nil)
+	resp = httptest.NewRecorder()
+	myRouter.ServeHTTP(resp, req)
+	assert.Equal(t, 200, resp.Code, "the cursor is expected to carry the price as the column holds it")
+}
+
+func TestListWithTotalCount(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	mockDatastore.EXPECT().GetCategorisedProducts(model.ProductQuery{Limit: 101}).Return(products(1, 3), nil)
+	mockDatastore.EXPECT().CountProducts(model.ProductQuery{Limit: 100}).Return(3, nil)
+	req, _ := http.NewRequest("GET", "/products?count=true&limit=5000", nil)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "OK is expected")
+	assert.Equal(t, "3", resp.Header().Get("X-Total-Count"), "X-Total-Count is expected")
+}
+
+func TestListFailureWithBadPaging(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	req, _ := http.NewRequest("GET", "/products?limit=0&offset=-1&cursor=nonsense", nil)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 400, resp.Code, "Bad Request is expected")
+	problem := Problem{}
+	json.NewDecoder(resp.Body).Decode(&problem)
+	assert.Equal(t, 3, len(problem.Errors), "every paging violation is expected")
+}
+
+func TestListFailureWithCursorOfAnotherSort(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	cursor := encodeCursor(productCursor{Sort: "price", Values: []string{"2", "2"}})
+	req, _ := http.NewRequest("GET", "/products?cursor="+cursor, nil)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 400, resp.Code, "Bad Request is expected")
+}
+
+func TestListWithFilters(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	req, _ := http.NewRequest("GET", "/products?price[gte]=10&categoryId[in]=1,2&name[prefix]=mil&expiry[before]=2025-01-01", nil)
+	filters := []model.Filter{
+		{Field: "categoryId", Op: model.OpIn, Values: []interface{}{1, 2}},
+		{Field: "expiry", Op: model.OpBefore, Values: []interface{}{time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}},
+		{Field: "name", Op: model.OpPrefix, Values: []interface{}{"mil"}},
+		{Field: "price", Op: model.OpGte, Values: []interface{}{10.0}},
+	}
+	mockDatastore.EXPECT().CategoryExists(1).Return(true, nil)
+	mockDatastore.EXPECT().CategoryExists(2).Return(true, nil)
+	mockDatastore.EXPECT().GetCategorisedProducts(model.ProductQuery{Filters: filters, Limit: 21}).Return(products(1, 1), nil)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "OK is expected")
+}
+
+func TestListWithInexactPriceFilters(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	req, _ := http.NewRequest("GET", "/products?price=12.3&price[lte]=12.3", nil)
+	price := float64(float32(12.3))
+	filters := []model.Filter{
+		{Field: "price", Op: model.OpEq, Values: []interface{}{price}},
+		{Field: "price", Op: model.OpLte, Values: []interface{}{price}},
+	}
+	mockDatastore.EXPECT().GetCategorisedProducts(model.ProductQuery{Filters: filters, Limit: 21}).Return(products(1, 1), nil)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "OK is expected")
+	assert.Equal(t, 12.300000190734863, price, "the filters are expected to bind the price as it is stored")
+}
+
+func TestListFailureWithUnknownFilterField(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	req, _ := http.NewRequest("GET", "/products?colour=red", nil)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 400, resp.Code, "Bad Request is expected")
+	problem := Problem{}
+	json.NewDecoder(resp.Body).Decode(&problem)
+	assert.Equal(t, []FieldError{{Field: "colour", Detail: "colour is not a field that can be filtered on"}}, problem.Errors, "unknown field is expected to be named")
+}
+
+func TestListFailureWithBadFilters(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	req, _ := http.NewRequest("GET", "/products?price[like]=1&categoryId[in]=1,x&expiry=2025-01-01", nil)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 400, resp.Code, "Bad Request is expected")
+	problem := Problem{}
+	json.NewDecoder(resp.Body).Decode(&problem)
+	assert.Equal(t, 3, len(problem.Errors), "every bad filter is expected")
+	assert.Equal(t, "categoryId[in]", problem.Errors[0].Field, "bad value is expected")
+	assert.Equal(t, "expiry", problem.Errors[1].Field, "missing operator is expected")
+	assert.Equal(t, "price[like]", problem.Errors[2].Field, "unknown operator is expected")
+}
+
+func TestListWithMultiKeySort(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	req, _ := http.NewRequest("GET", "/products?sort=-price,name,expiry", nil)
+	sort := []model.SortKey{{Field: "price", Desc: true}, {Field: "name"}, {Field: "expiry"}}
+	mockDatastore.EXPECT().GetCategorisedProducts(model.ProductQuery{Sort: sort, Limit: 21}).Return(products(1, 1), nil)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "OK is expected")
+}
+
+func TestListWithAscendingOrder(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	req, _ := http.NewRequest("GET", "/products?sort=price&order=asc", nil)
+	mockDatastore.EXPECT().GetCategorisedProducts(model.ProductQuery{Sort: []model.SortKey{{Field: "price"}}, Limit: 21}).Return(products(1, 1), nil)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "OK is expected")
+}
+
+func TestListFailureWithUnknownSortKey(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	req, _ := http.NewRequest("GET", "/products?sort=price,colour,price&order=up", nil)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 400, resp.Code, "Bad Request is expected")
+	problem := Problem{}
+	json.NewDecoder(resp.Body).Decode(&problem)
+	assert.Equal(t, []FieldError{
+		{Field: "order", Detail: "order must be asc or desc"},
+		{Field: "sort", Detail: `cannot sort on "colour"`},
+		{Field: "sort", Detail: "price is sorted on twice"},
+	}, problem.Errors, "every bad sort key is expected")
+}
+
+func TestSearchProducts(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	searcher := datastore.NewMemorySearcher(model.Product{Id: 1, Name: "Whole Milk", Price: 2, CategoryId: 3}, model.Product{Id: 2, Name: "Bread", Price: 1, CategoryId: 3})
+	ctrl := NewController(mockDatastore, WithSearcher(searcher))
+	req, _ := http.NewRequest("GET", "/products/search?q=mlik", nil)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "OK is expected")
+	var body []ProductSearchResult
+	json.NewDecoder(resp.Body).Decode(&body)
+	assert.Equal(t, 1, len(body), "one hit is expected")
+	assert.Equal(t, "Whole Milk", body[0].Name, "misspelled product is expected")
+	assert.Equal(t, "Whole <b>Milk</b>", body[0].Highlight, "highlight is expected")
+}
+
+func TestSearchFailureWithoutQuery(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore, WithSearcher(datastore.NewMemorySearcher()))
+	req, _ := http.NewRequest("GET", "/products/search?limit=x", nil)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 400, resp.Code, "Bad Request is expected")
+	problem := Problem{}
+	json.NewDecoder(resp.Body).Decode(&problem)
+	assert.Equal(t, 2, len(problem.Errors), "missing query and bad limit are expected")
+}
+
+func TestSuggestFollowsWrites(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	mockDatastore.EXPECT().GetCategorisedProducts(model.ProductQuery{}).Return([]model.Product{{Id: 1, Name: "Whole Milk"}}, nil)
+	mockDatastore.EXPECT().Create(gomock.Any()).DoAndReturn(func(prod *model.Product) error {
+		prod.Id = 2
+		return nil
+	})
+	names, _ := datastore.NewNameIndex(mockDatastore)
+	ctrl := NewController(datastore.NewIndexedDatastore(mockDatastore, names), WithSuggester(names))
+	myRouter := NewRouter(ctrl)
+	create, _ := http.NewRequest("POST", "/products", strings.NewReader(`{"name":"Milkshake","price":2,"categoryId":3}`))
+	myRouter.ServeHTTP(httptest.NewRecorder(), create)
+	req, _ := http.NewRequest("GET", "/products/suggest?prefix=mil", nil)
+	resp := httptest.NewRecorder()
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "OK is expected")
+	var body []SuggestionResponse
+	json.NewDecoder(resp.Body).Decode(&body)
+	assert.Equal(t, []SuggestionResponse{{Id: 1, Name: "Whole Milk"}, {Id: 2, Name: "Milkshake"}}, body, "stored and created products are expected")
+}
+
+func TestSuggestFailureWithoutPrefix(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore, WithSuggester(&datastore.NameIndex{}))
+	req, _ := http.NewRequest("GET", "/products/suggest", nil)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 400, resp.Code, "Bad Request is expected")
+}
+
+func TestListWithSparseFieldset(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	req, _ := http.NewRequest("GET", "/products?fields=price,name", nil)
+	mockDatastore.EXPECT().GetCategorisedProducts(model.ProductQuery{Fields: []string{"name", "price"}, Limit: 21}).Return([]model.Product{{Id: 3, Name: "prod120", Price: 100}}, nil)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "OK is expected")
+	assert.JSONEq(t, `[{"name":"prod120","price":100}]`, resp.Body.String(), "only the requested fields are expected")
+}
+
+func TestGetOneWithExcludedFields(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	req, _ := http.NewRequest("GET", "/products/3?exclude=expiry,categoryId,onHand,reserved,available", nil)
+	mockDatastore.EXPECT().GetProductFields(3, []string{"id", "name", "price", "effectivePrice", "markdown"}, gomock.Any()).
+		DoAndReturn(func(id int, fields []string, p *model.Product) error {
+			*p = model.Product{Id: 3, Name: "prod120", Price: 100, Version: 1}
+			return nil
+		})
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "OK is expected")
+	assert.JSONEq(t, `{"id":3,"name":"prod120","price":100}`, resp.Body.String(), "excluded fields are expected to be left out")
+}
+
+func TestGetOneWithFieldsLoadsTheMarkdown(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	mockPricer := mocks.NewMockPricer(mockCtrl)
+	ctrl := NewController(mockDatastore, WithPricing(mockPricer))
+	req, _ := http.NewRequest("GET", "/products/3?fields=id,effectivePrice", nil)
+	prod := model.Product{Id: 3, Price: 10, Expiry: time.Now().Add(time.Hour), CategoryId: 2, Version: 4}
+	mockDatastore.EXPECT().GetProductFields(3, []string{"id", "effectivePrice", "markdown"}, gomock.Any()).
+		DoAndReturn(func(id int, fields []string, p *model.Product) error {
+			*p = prod
+			return nil
+		})
+	mockPricer.EXPECT().Markdown(prod).Return(model.Markdown{Percent: 50, Price: 5}, true)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "OK is expected")
+	assert.Equal(t, `"4-50"`, resp.Header().Get("ETag"), "the ETag of the marked down product is expected")
+	assert.JSONEq(t, `{"id":3,"effectivePrice":5}`, resp.Body.String(), "only the requested fields are expected")
+}
+
+func TestListFailureWithUnknownField(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	req, _ := http.NewRequest("GET", "/products?fields=name,colour", nil)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 400, resp.Code, "Bad Request is expected")
+	problem := Problem{}
+	json.NewDecoder(resp.Body).Decode(&problem)
+	assert.Equal(t, []FieldError{{Field: "fields", Detail: `"colour" is not a product field`}}, problem.Errors, "unknown field is expected")
+}
+
+func TestListEmptyCategoryIsNotAnError(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	req, _ := http.NewRequest("GET", "/products?categoryId=4", nil)
+	mockDatastore.EXPECT().CategoryExists(4).Return(true, nil)
+	mockDatastore.EXPECT().GetCategorisedProducts(gomock.Any()).Return([]model.Product{}, nil)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "OK is expected")
+	assert.JSONEq(t, `[]`, resp.Body.String(), "an empty list is expected")
+}
+
+func TestListEmptyWithoutProducts(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	req, _ := http.NewRequest("GET", "/products", nil)
+	mockDatastore.EXPECT().GetCategorisedProducts(model.ProductQuery{Limit: 21}).Return(nil, nil)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "OK is expected")
+	assert.JSONEq(t, `[]`, resp.Body.String(), "an empty list is expected")
+}
+
+func TestListFailureWithMalformedCategory(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	req, _ := http.NewRequest("GET", "/products?categoryId=dairy", nil)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 400, resp.Code, "Bad Request is expected")
+}
+
+func TestCreateCategoryDerivesSlug(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockCategories := mocks.NewMockCategoryDatastore(mockCtrl)
+	ctrl := NewController(mocks.NewMockDatastore(mockCtrl), WithCategories(mockCategories))
+	parent := 1
+	mockCategories.EXPECT().CreateCategory(&model.Category{Name: "Dairy & Eggs", Slug: "dairy-eggs", ParentId: &parent}).DoAndReturn(func(c *model.Category) error {
+		c.Id = 7
+		return nil
+	})
+	req, _ := http.NewRequest("POST", "/categories", strings.NewReader(`{"name":"Dairy & Eggs","parentId":1}`))
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 201, resp.Code, "Created is expected")
+	assert.Equal(t, "/categories/7", resp.Header().Get("Location"), "Location is expected")
+	assert.JSONEq(t, `{"id":7,"name":"Dairy & Eggs","slug":"dairy-eggs","parentId":1,"description":""}`, resp.Body.String(), "created category is expected")
+}
+
+func TestCreateCategoryFailureWithBadSlug(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	ctrl := NewController(mocks.NewMockDatastore(mockCtrl), WithCategories(mocks.NewMockCategoryDatastore(mockCtrl)))
+	req, _ := http.NewRequest("POST", "/categories", strings.NewReader(`{"name":"Dairy","slug":"Dairy Products"}`))
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 400, resp.Code, "Bad Request is expected")
+}
+
+func TestUpdateCategoryFailureAsItsOwnParent(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockCategories := mocks.NewMockCategoryDatastore(mockCtrl)
+	ctrl := NewController(mocks.NewMockDatastore(mockCtrl), WithCategories(mockCategories))
+	mockCategories.EXPECT().GetCategory(4, gomock.Any()).DoAndReturn(func(id int, c *model.Category) error {
+		*c = model.Category{Id: 4, Name: "Dairy", Slug: "dairy"}
+		return nil
+	})
+	req, _ := http.NewRequest("PUT", "/categories/4", strings.NewReader(`{"name":"Dairy","parentId":4}`))
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 400, resp.Code, "Bad Request is expected")
+}
+
+func TestDeleteCategoryFailureWithProducts(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockCategories := mocks.NewMockCategoryDatastore(mockCtrl)
+	ctrl := NewController(mocks.NewMockDatastore(mockCtrl), WithCategories(mockCategories))
+	mockCategories.EXPECT().DeleteCategory(4, 0).Return(fmt.Errorf("%w: category 4 still has 2 products and 0 subcategories", datastore.ErrConflict))
+	req, _ := http.NewRequest("DELETE", "/categories/4", nil)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 409, resp.Code, "Conflict is expected")
+}
+
+func TestDeleteCategoryReassigningProducts(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockCategories := mocks.NewMockCategoryDatastore(mockCtrl)
+	ctrl := NewController(mocks.NewMockDatastore(mockCtrl), WithCategories(mockCategories))
+	mockCategories.EXPECT().DeleteCategory(4, 9).Return(nil)
+	req, _ := http.NewRequest("DELETE", "/categories/4?cascade=reassign:9", nil)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "OK is expected")
+}
+
+func TestDeleteCategoryFailureWithBadCascade(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	ctrl := NewController(mocks.NewMockDatastore(mockCtrl), WithCategories(mocks.NewMockCategoryDatastore(mockCtrl)))
+	req, _ := http.NewRequest("DELETE", "/categories/4?cascade=delete", nil)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 400, resp.Code, "Bad Request is expected")
+}
+
+func TestListWithDescendantCategories(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	req, _ := http.NewRequest("GET", "/products?categoryId=5&includeDescendants=true", nil)
+	mockDatastore.EXPECT().CategoryExists(5).Return(true, nil)
+	mockDatastore.EXPECT().GetCategorisedProducts(model.ProductQuery{Filters: []model.Filter{{Field: "categoryId", Op: model.OpUnder, Values: []interface{}{5}}}, Limit: 21}).Return(products(1, 2), nil)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "OK is expected")
+}
+
+func TestCategoryTree(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockCategories := mocks.NewMockCategoryDatastore(mockCtrl)
+	ctrl := NewController(mocks.NewMockDatastore(mockCtrl), WithCategories(mockCategories))
+	food, dairy := 1, 2
+	mockCategories.EXPECT().ListCategories().Return([]model.Category{
+		{Id: 3, Name: "Cheese", Slug: "cheese", ParentId: &dairy},
+		{Id: 2, Name: "Dairy", Slug: "dairy", ParentId: &food},
+		{Id: 1, Name: "Food", Slug: "food"},
+		{Id: 4, Name: "Tools", Slug: "tools"},
+	}, nil)
+	req, _ := http.NewRequest("GET", "/categories/tree", nil)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "OK is expected")
+	assert.JSONEq(t, `[
+		{"id":1,"name":"Food","slug":"food","parentId":null,"description":"","children":[
+			{"id":2,"name":"Dairy","slug":"dairy","parentId":1,"description":"","children":[
+				{"id":3,"name":"Cheese","slug":"cheese","parentId":2,"description":"","children":[]}
+			]}
+		]},
+		{"id":4,"name":"Tools","slug":"tools","parentId":null,"description":"","children":[]}
+	]`, resp.Body.String(), "nested categories are expected")
+}
+
+func TestAdjustStock(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockStock := mocks.NewMockStockDatastore(mockCtrl)
+	ctrl := NewController(mocks.NewMockDatastore(mockCtrl), WithStock(mockStock))
+	adj := model.StockAdjustment{ProductId: 3, OnHand: -2, Reserved: -2, Reason: model.ReasonSale, Actor: "jane"}
+	mockStock.EXPECT().AdjustStock(adj, gomock.Any()).DoAndReturn(func(adj model.StockAdjustment, prod *model.Product) error {
+		*prod = model.Product{Id: 3, Name: "prod120", Price: 100, CategoryId: 2, OnHand: 8, Reserved: 1, Version: 4}
+		return nil
+	})
+	req, _ := http.NewRequest("POST", "/products/3/stock", strings.NewReader(`{"onHand":-2,"reserved":-2,"reason":"sale"}`))
+	req.Header.Set("X-Actor", "jane")
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "OK is expected")
+	assert.Equal(t, `"4"`, resp.Header().Get("ETag"), "ETag of the new version is expected")
+	body := ProductResponse{}
+	json.NewDecoder(resp.Body).Decode(&body)
+	assert.Equal(t, 7, body.Available, "available stock is expected")
+}
+
+func TestAdjustStockFailureWithInsufficientStock(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockStock := mocks.NewMockStockDatastore(mockCtrl)
+	ctrl := NewController(mocks.NewMockDatastore(mockCtrl), WithStock(mockStock))
+	mockStock.EXPECT().AdjustStock(gomock.Any(), gomock.Any()).Return(fmt.Errorf("%w: 1 on hand and 0 reserved", datastore.ErrInsufficientStock))
+	req, _ := http.NewRequest("POST", "/products/3/stock", strings.NewReader(`{"onHand":-2,"reason":"write-off"}`))
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 409, resp.Code, "Conflict is expected")
+}
+
+func TestAdjustStockFailureWithoutReason(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	ctrl := NewController(mocks.NewMockDatastore(mockCtrl), WithStock(mocks.NewMockStockDatastore(mockCtrl)))
+	req, _ := http.NewRequest("POST", "/products/3/stock", strings.NewReader(`{"reason":"lost"}`))
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 400, resp.Code, "Bad Request is expected")
+	problem := Problem{}
+	json.NewDecoder(resp.Body).Decode(&problem)
+	assert.Equal(t, 2, len(problem.Errors), "missing amount and unknown reason are expected")
+}
+
+func TestPatchFailureChangingStock(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	mockDatastore.EXPECT().GetProduct(3, gomock.Any()).DoAndReturn(stored(model.Product{Id: 3, Name: "prod120", Price: 100, CategoryId: 2, OnHand: 5, Version: 1}))
+	req, _ := http.NewRequest("PATCH", "/products/3", strings.NewReader(`{"onHand":50}`))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 400, resp.Code, "Bad Request is expected")
+}
+
+func TestListMovements(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	mockStock := mocks.NewMockStockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore, WithStock(mockStock))
+	mockDatastore.EXPECT().GetProduct(3, gomock.Any()).Return(nil)
+	created := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	mockStock.EXPECT().ListMovements(3, 3, 2).Return([]model.StockMovement{
+		{Id: 9, ProductId: 3, Delta: -1, Reason: model.ReasonSale, Reference: "order 12", Actor: "jane", CreatedAt: created},
+		{Id: 8, ProductId: 3, Delta: 5, Reason: model.ReasonReceipt, CreatedAt: created},
+		{Id: 7, ProductId: 3, Delta: 5, Reason: model.ReasonReceipt, CreatedAt: created},
+	}, nil)
+	req, _ := http.NewRequest("GET", "/products/3/movements?limit=2&offset=2", nil)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "OK is expected")
+	assert.Equal(t, `</products/3/movements?limit=2&offset=4>; rel="next", </products/3/movements?limit=2&offset=0>; rel="prev"`, resp.Header().Get("Link"), "links to both neighbours are expected")
+	var body []StockMovementResponse
+	json.NewDecoder(resp.Body).Decode(&body)
+	assert.Equal(t, 2, len(body), "one page is expected")
+	assert.Equal(t, StockMovementResponse{Id: 9, ProductId: 3, Delta: -1, Reason: "sale", Reference: "order 12", Actor: "jane", CreatedAt: "2024-05-01T10:00:00Z"}, body[0], "newest movement is expected first")
+}
+
+func TestAdjustStockAtLocation(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockStock := mocks.NewMockStockDatastore(mockCtrl)
+	ctrl := NewController(mocks.NewMockDatastore(mockCtrl), WithStock(mockStock))
+	adj := model.StockAdjustment{ProductId: 3, LocationId: 2, OnHand: 10, Reason: model.ReasonReceipt}
+	mockStock.EXPECT().AdjustStock(adj, gomock.Any()).Return(nil)
+	req, _ := http.NewRequest("POST", "/products/3/stock", strings.NewReader(`{"locationId":2,"onHand":10,"reason":"receipt"}`))
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "OK is expected")
+}
+
+func TestTransferStock(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockStock := mocks.NewMockStockDatastore(mockCtrl)
+	ctrl := NewController(mocks.NewMockDatastore(mockCtrl), WithStock(mockStock))
+	transfer := model.StockTransfer{ProductId: 3, FromLocationId: 1, ToLocationId: 2, Quantity: 4, Reference: "rebalance", Actor: "jane"}
+	mockStock.EXPECT().TransferStock(transfer, gomock.Any(), gomock.Any()).DoAndReturn(func(t model.StockTransfer, from, to *model.StockLevel) error {
+		*from = model.StockLevel{ProductId: 3, LocationId: 1, OnHand: 6, Reserved: 1}
+		*to = model.StockLevel{ProductId: 3, LocationId: 2, OnHand: 4}
+		return nil
+	})
+	req, _ := http.NewRequest("POST", "/products/3/transfers", strings.NewReader(`{"fromLocationId":1,"toLocationId":2,"quantity":4,"reference":"rebalance"}`))
+	req.Header.Set("X-Actor", "jane")
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "OK is expected")
+	body := StockTransferResponse{}
+	json.NewDecoder(resp.Body).Decode(&body)
+	assert.Equal(t, StockLevelResponse{LocationId: 1, OnHand: 6, Reserved: 1, Available: 5}, body.From, "stock left at the source is expected")
+	assert.Equal(t, StockLevelResponse{LocationId: 2, OnHand: 4, Available: 4}, body.To, "stock at the destination is expected")
+}
+
+func TestTransferStockFailureWithInsufficientStock(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockStock := mocks.NewMockStockDatastore(mockCtrl)
+	ctrl := NewController(mocks.NewMockDatastore(mockCtrl), WithStock(mockStock))
+	mockStock.EXPECT().TransferStock(gomock.Any(), gomock.Any(), gomock.Any()).Return(fmt.Errorf("%w: less than 4 units available at location 1", datastore.ErrInsufficientStock))
+	req, _ := http.NewRequest("POST", "/products/3/transfers", strings.NewReader(`{"fromLocationId":1,"toLocationId":2,"quantity":4}`))
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 409, resp.Code, "Conflict is expected")
+}
+
+func TestTransferStockFailureToSameLocation(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	ctrl := NewController(mocks.NewMockDatastore(mockCtrl), WithStock(mocks.NewMockStockDatastore(mockCtrl)))
+	req, _ := http.NewRequest("POST", "/products/3/transfers", strings.NewReader(`{"fromLocationId":1,"toLocationId":1}`))
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 400, resp.Code, "Bad Request is expected")
+	problem := Problem{}
+	json.NewDecoder(resp.Body).Decode(&problem)
+	assert.Equal(t, 2, len(problem.Errors), "same location and missing quantity are expected")
+}
+
+func TestListLocationProducts(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockLocations := mocks.NewMockLocationDatastore(mockCtrl)
+	ctrl := NewController(mocks.NewMockDatastore(mockCtrl), WithLocations(mockLocations))
+	mockLocations.EXPECT().GetLocation(2, gomock.Any()).Return(nil)
+	mockLocations.EXPECT().ListLocationStock(2, 2, 0).Return([]model.LocationStock{
+		{Product: model.Product{Id: 3, Name: "prod120", Price: 100, CategoryId: 2, OnHand: 9}, Level: model.StockLevel{ProductId: 3, LocationId: 2, OnHand: 4, Reserved: 1}},
+		{Product: model.Product{Id: 5, Name: "prod121", Price: 50, CategoryId: 2, OnHand: 1}, Level: model.StockLevel{ProductId: 5, LocationId: 2, OnHand: 1}},
+	}, nil)
+	req, _ := http.NewRequest("GET", "/locations/2/products?limit=1", nil)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "OK is expected")
+	assert.Equal(t, `</locations/2/products?limit=1&offset=1>; rel="next"`, resp.Header().Get("Link"), "link to the next page is expected")
+	var body []LocationStockResponse
+	json.NewDecoder(resp.Body).Decode(&body)
+	assert.Equal(t, 1, len(body), "one page is expected")
+	assert.Equal(t, 3, body[0].Product.Id, "product is expected")
+	assert.Equal(t, 3, body[0].Available, "stock at the location rather than in total is expected")
+}
+
+func TestListLocationProductsWithMarkdown(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockLocations := mocks.NewMockLocationDatastore(mockCtrl)
+	mockPricer := mocks.NewMockPricer(mockCtrl)
+	ctrl := NewController(mocks.NewMockDatastore(mockCtrl), WithLocations(mockLocations), WithPricing(mockPricer))
+	prod := model.Product{Id: 3, Name: "prod120", Price: 10, CategoryId: 2, Expiry: time.Date(2024, 5, 12, 0, 0, 0, 0, time.UTC)}
+	mockLocations.EXPECT().GetLocation(2, gomock.Any()).Return(nil)
+	mockLocations.EXPECT().ListLocationStock(2, 21, 0).Return([]model.LocationStock{{Product: prod, Level: model.StockLevel{ProductId: 3, LocationId: 2, OnHand: 4}}}, nil)
+	mockPricer.EXPECT().Markdown(prod).Return(model.Markdown{ProductId: 3, Percent: 20, ListPrice: 10, Price: 8}, true)
+	req, _ := http.NewRequest("GET", "/locations/2/products", nil)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "OK is expected")
+	var body []LocationStockResponse
+	json.NewDecoder(resp.Body).Decode(&body)
+	assert.Equal(t, float32(8), *body[0].Product.EffectivePrice, "the marked down price is expected")
+	assert.Equal(t, float64(20), body[0].Product.Markdown, "the markdown is expected")
+}
+
+func TestListLocationProductsFailureWithUnknownLocation(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockLocations := mocks.NewMockLocationDatastore(mockCtrl)
+	ctrl := NewController(mocks.NewMockDatastore(mockCtrl), WithLocations(mockLocations))
+	mockLocations.EXPECT().GetLocation(8, gomock.Any()).Return(datastore.ErrNotFound)
+	req, _ := http.NewRequest("GET", "/locations/8/products", nil)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 404, resp.Code, "Not Found is expected")
+}
+
+func TestCreateLocationFailureWithBadCode(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	ctrl := NewController(mocks.NewMockDatastore(mockCtrl), WithLocations(mocks.NewMockLocationDatastore(mockCtrl)))
+	req, _ := http.NewRequest("POST", "/locations", strings.NewReader(`{"name":"North Warehouse","code":"North WH"}`))
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 400, resp.Code, "Bad Request is expected")
+}
+
+func TestReceiveLot(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockLots := mocks.NewMockLotDatastore(mockCtrl)
+	ctrl := NewController(mocks.NewMockDatastore(mockCtrl), WithLots(mockLots))
+	expiry := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	lot := model.Lot{ProductId: 3, LotNumber: "L-0042", Quantity: 12, Expiry: &expiry}
+	mockLots.EXPECT().ReceiveLot(&lot, "delivery 7", "jane").DoAndReturn(func(lot *model.Lot, reference, actor string) error {
+		lot.Id = 5
+		lot.LocationId = 1
+		lot.ReceivedAt = time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+		return nil
+	})
+	req, _ := http.NewRequest("POST", "/products/3/lots", strings.NewReader(`{"lotNumber":"L-0042","quantity":12,"expiry":"2024-06-01T00:00:00Z","reference":"delivery 7"}`))
+	req.Header.Set("X-Actor", "jane")
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 201, resp.Code, "Created is expected")
+	assert.Equal(t, "/products/3/lots/5", resp.Header().Get("Location"), "Location of the lot is expected")
+	body := LotResponse{}
+	json.NewDecoder(resp.Body).Decode(&body)
+	assert.Equal(t, LotResponse{Id: 5, ProductId: 3, LotNumber: "L-0042", LocationId: 1, Quantity: 12, Expiry: "2024-06-01T00:00:00Z", ReceivedAt: "2024-05-01T10:00:00Z"}, body, "stored lot is expected")
+}
+
+func TestReceiveLotFailureWithBadFields(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	ctrl := NewController(mocks.NewMockDatastore(mockCtrl), WithLots(mocks.NewMockLotDatastore(mockCtrl)))
+	req, _ := http.NewRequest("POST", "/products/3/lots", strings.NewReader(`{"quantity":0,"expiry":"next week"}`))
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 400, resp.Code, "Bad Request is expected")
+	problem := Problem{}
+	json.NewDecoder(resp.Body).Decode(&problem)
+	assert.Equal(t, 3, len(problem.Errors), "missing lot number, quantity and malformed expiry are expected")
+}
+
+func TestListLots(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	mockLots := mocks.NewMockLotDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore, WithLots(mockLots))
+	expiry := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	received := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	mockDatastore.EXPECT().GetProduct(3, gomock.Any()).Return(nil)
+	mockLots.EXPECT().ListLots(3).Return([]model.Lot{
+		{Id: 5, ProductId: 3, LotNumber: "L-0042", LocationId: 1, Quantity: 12, Expiry: &expiry, ReceivedAt: received},
+		{Id: 6, ProductId: 3, LotNumber: "L-0043", LocationId: 1, Quantity: 2, ReceivedAt: received},
+	}, nil)
+	req, _ := http.NewRequest("GET", "/products/3/lots", nil)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "OK is expected")
+	var body []LotResponse
+	json.NewDecoder(resp.Body).Decode(&body)
+	assert.Equal(t, 2, len(body), "every lot is expected")
+	assert.Equal(t, "", body[1].Expiry, "no expiry is expected for a lot that does not expire")
+}
+
+func TestAdjustLotFailureWithInsufficientStock(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockLots := mocks.NewMockLotDatastore(mockCtrl)
+	ctrl := NewController(mocks.NewMockDatastore(mockCtrl), WithLots(mockLots))
+	adj := model.LotAdjustment{ProductId: 3, LotId: 5, Quantity: -20, Reason: model.ReasonWriteOff}
+	mockLots.EXPECT().AdjustLot(adj, gomock.Any()).Return(fmt.Errorf("%w: 12 units left in lot L-0042", datastore.ErrInsufficientStock))
+	req, _ := http.NewRequest("POST", "/products/3/lots/5/stock", strings.NewReader(`{"quantity":-20,"reason":"write-off"}`))
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 409, resp.Code, "Conflict is expected")
+}
+
+func TestAllocate(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockAllocator := mocks.NewMockAllocator(mockCtrl)
+	ctrl := NewController(mocks.NewMockDatastore(mockCtrl), WithAllocator(mockAllocator))
+	expiry := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	allocation := model.Allocation{ProductId: 3, LocationId: 2, Quantity: 7, Reference: "order 12", Actor: "jane"}
+	mockAllocator.EXPECT().Allocate(allocation).Return([]model.Pick{
+		{LotId: 5, LotNumber: "L-0042", LocationId: 2, Quantity: 4, Expiry: &expiry},
+		{LotId: 6, LotNumber: "L-0043", LocationId: 2, Quantity: 3},
+	}, nil)
+	req, _ := http.NewRequest("POST", "/products/3/allocate", strings.NewReader(`{"quantity":7,"locationId":2,"reference":"order 12"}`))
+	req.Header.Set("X-Actor", "jane")
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "OK is expected")
+	body := AllocationResponse{}
+	json.NewDecoder(resp.Body).Decode(&body)
+	assert.Equal(t, AllocationResponse{ProductId: 3, Quantity: 7, Picks: []PickResponse{
+		{LotId: 5, LotNumber: "L-0042", LocationId: 2, Quantity: 4, Expiry: "2024-06-01T00:00:00Z"},
+		{LotId: 6, LotNumber: "L-0043", LocationId: 2, Quantity: 3},
+	}}, body, "pick list is expected")
+}
+
+func TestAllocateFailureWithInsufficientStock(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockAllocator := mocks.NewMockAllocator(mockCtrl)
+	ctrl := NewController(mocks.NewMockDatastore(mockCtrl), WithAllocator(mockAllocator))
+	mockAllocator.EXPECT().Allocate(gomock.Any()).Return(nil, fmt.Errorf("%w: 4 of 7 units can be picked", datastore.ErrInsufficientStock))
+	req, _ := http.NewRequest("POST", "/products/3/allocate", strings.NewReader(`{"quantity":7}`))
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 409, resp.Code, "Conflict is expected")
+}
+
+func TestAllocateFailureWithoutQuantity(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	ctrl := NewController(mocks.NewMockDatastore(mockCtrl), WithAllocator(mocks.NewMockAllocator(mockCtrl)))
+	req, _ := http.NewRequest("POST", "/products/3/allocate", strings.NewReader(`{}`))
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 400, resp.Code, "Bad Request is expected")
+}
+
+func TestExpiringReport(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	mockExpiry := mocks.NewMockExpiryDatastore(mockCtrl)
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+	ctrl := NewController(mockDatastore, WithExpiry(mockExpiry), WithClock(func() time.Time { return now }))
+	mockDatastore.EXPECT().CategoryExists(2).Return(true, nil)
+	mockExpiry.EXPECT().ExpiringStock(now, now.Add(3*24*time.Hour), 2).Return([]model.ExpiringStock{
+		{ProductId: 3, ProductName: "prod120", CategoryId: 2, LotId: 5, LotNumber: "L-0042", LocationId: 1, Quantity: 4, Expiry: time.Date(2024, 5, 11, 0, 0, 0, 0, time.UTC)},
+		{ProductId: 7, ProductName: "prod121", CategoryId: 2, LocationId: 1, Quantity: 2, Expiry: time.Date(2024, 5, 12, 0, 0, 0, 0, time.UTC)},
+	}, nil)
+	req, _ := http.NewRequest("GET", "/reports/expiring?within=3d&categoryId=2", nil)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "OK is expected")
+	var body []ExpiringStockResponse
+	json.NewDecoder(resp.Body).Decode(&body)
+	assert.Equal(t, []ExpiringStockResponse{
+		{ProductId: 3, ProductName: "prod120", CategoryId: 2, LotId: 5, LotNumber: "L-0042", LocationId: 1, Quantity: 4, Expiry: "2024-05-11T00:00:00Z"},
+		{ProductId: 7, ProductName: "prod121", CategoryId: 2, LocationId: 1, Quantity: 2, Expiry: "2024-05-12T00:00:00Z"},
+	}, body, "the expiring lot and stock are expected")
+}
+
+func TestExpiringReportDefaultsToAWeek(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockExpiry := mocks.NewMockExpiryDatastore(mockCtrl)
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+	ctrl := NewController(mocks.NewMockDatastore(mockCtrl), WithExpiry(mockExpiry), WithClock(func() time.Time { return now }))
+	mockExpiry.EXPECT().ExpiringStock(now, now.Add(7*24*time.Hour), 0).Return(nil, nil)
+	req, _ := http.NewRequest("GET", "/reports/expiring", nil)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "OK is expected")
+	assert.Equal(t, "[]", strings.TrimSpace(resp.Body.String()), "an empty report is expected")
+}
+
+func TestExpiringReportFailureWithBadParameters(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	ctrl := NewController(mocks.NewMockDatastore(mockCtrl), WithExpiry(mocks.NewMockExpiryDatastore(mockCtrl)))
+	req, _ := http.NewRequest("GET", "/reports/expiring?within=soon&categoryId=dairy", nil)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 400, resp.Code, "Bad Request is expected")
+	problem := Problem{}
+	json.NewDecoder(resp.Body).Decode(&problem)
+	assert.Equal(t, 2, len(problem.Errors), "both parameters are expected to be reported")
+}
+
+func TestExpiringReportFailureWithUnknownCategory(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore, WithExpiry(mocks.NewMockExpiryDatastore(mockCtrl)))
+	mockDatastore.EXPECT().CategoryExists(9).Return(false, nil)
+	req, _ := http.NewRequest("GET", "/reports/expiring?categoryId=9", nil)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 404, resp.Code, "Not Found is expected")
+}
+
+func TestGetOneWithMarkdown(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	mockPricer := mocks.NewMockPricer(mockCtrl)
+	ctrl := NewController(mockDatastore, WithPricing(mockPricer))
+	updated := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	prod := model.Product{Id: 3, Name: "prod120", Price: 10, CategoryId: 2, Version: 4, UpdatedAt: updated, Expiry: time.Date(2024, 5, 12, 0, 0, 0, 0, time.UTC)}
+	mockDatastore.EXPECT().GetProduct(3, gomock.Any()).DoAndReturn(stored(prod))
+	mockPricer.EXPECT().Markdown(prod).Return(model.Markdown{ProductId: 3, Percent: 20, ListPrice: 10, Price: 8, StartsAt: time.Date(2024, 5, 9, 0, 0, 0, 0, time.UTC)}, true)
+	req, _ := http.NewRequest("GET", "/products/3", nil)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "OK is expected")
+	assert.Equal(t, `"4-20"`, resp.Header().Get("ETag"), "the markdown is expected in the ETag")
+	assert.Equal(t, "Thu, 09 May 2024 00:00:00 GMT", resp.Header().Get("Last-Modified"), "the start of the markdown is expected")
+	body := ProductResponse{}
+	json.NewDecoder(resp.Body).Decode(&body)
+	assert.Equal(t, float32(10), body.Price, "the list price is expected")
+	assert.Equal(t, float32(8), *body.EffectivePrice, "the marked down price is expected")
+	assert.Equal(t, float64(20), body.Markdown, "the markdown is expected")
+}
+
+func TestListWithEffectivePriceField(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	mockPricer := mocks.NewMockPricer(mockCtrl)
+	ctrl := NewController(mockDatastore, WithPricing(mockPricer))
+	mockDatastore.EXPECT().GetCategorisedProducts(gomock.Any()).Return([]model.Product{{Id: 3, Price: 10}}, nil)
+	mockPricer.EXPECT().Markdown(gomock.Any()).Return(model.Markdown{}, false)
+	req, _ := http.NewRequest("GET", "/products?fields=id,effectivePrice,markdown", nil)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "OK is expected")
+	assert.JSONEq(t, `[{"id":3,"effectivePrice":10}]`, resp.Body.String(), "the list price as effective price and no markdown are expected")
+}
+
+func TestUpdateWithMarkedDownETag(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore)
+	current := model.Product{Id: 3, Name: "prod120", Price: 10, CategoryId: 2, Version: 4}
+	mockDatastore.EXPECT().GetProduct(3, gomock.Any()).DoAndReturn(stored(current))
+	mockDatastore.EXPECT().Save(gomock.Any()).Return(nil)
+	req, _ := http.NewRequest("PUT", "/products/3", strings.NewReader(`{"name":"prod120","price":12,"categoryId":2}`))
+	req.Header.Set("If-Match", `"4-20"`)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "the tag of a marked down read is expected to match its version")
+}
+
+func TestPatchFailureChangingEffectivePrice(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	mockPricer := mocks.NewMockPricer(mockCtrl)
+	ctrl := NewController(mockDatastore, WithPricing(mockPricer))
+	mockDatastore.EXPECT().GetProduct(3, gomock.Any()).DoAndReturn(stored(model.Product{Id: 3, Name: "prod120", Price: 10, CategoryId: 2, Version: 1}))
+	mockPricer.EXPECT().Markdown(gomock.Any()).Return(model.Markdown{}, false)
+	req, _ := http.NewRequest("PATCH", "/products/3", strings.NewReader(`{"effectivePrice":5}`))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 400, resp.Code, "Bad Request is expected")
+}
+
+func TestPatchTestsTheEffectivePrice(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	mockPricer := mocks.NewMockPricer(mockCtrl)
+	ctrl := NewController(mockDatastore, WithPricing(mockPricer))
+	mockDatastore.EXPECT().GetProduct(3, gomock.Any()).DoAndReturn(stored(model.Product{Id: 3, Name: "prod120", Price: 10, CategoryId: 2, Version: 1}))
+	mockPricer.EXPECT().Markdown(gomock.Any()).Return(model.Markdown{Percent: 50, Price: 5}, true).Times(2)
+	mockDatastore.EXPECT().Update(gomock.Any(), map[string]interface{}{"Name": "prod121"}).DoAndReturn(func(p *model.Product, fields map[string]interface{}) error {
+		p.Version = 2
+		return nil
+	})
+	req, _ := http.NewRequest("PATCH", "/products/3", strings.NewReader(`[{"op":"test","path":"/effectivePrice","value":5},{"op":"replace","path":"/name","value":"prod121"}]`))
+	req.Header.Set("Content-Type", "application/json-patch+json")
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "OK is expected")
+	assert.Equal(t, `"2-50"`, resp.Header().Get("ETag"), "the ETag of the marked down product is expected")
+	assert.Contains(t, resp.Body.String(), `"effectivePrice":5`, "the priced product is expected")
+}
+
+func TestListMarkdowns(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDatastore := mocks.NewMockDatastore(mockCtrl)
+	mockPricer := mocks.NewMockPricer(mockCtrl)
+	mockMarkdowns := mocks.NewMockMarkdownDatastore(mockCtrl)
+	ctrl := NewController(mockDatastore, WithPricing(mockPricer), WithMarkdownHistory(mockMarkdowns))
+	prod := model.Product{Id: 3, Name: "prod120", Price: 10, CategoryId: 2, Expiry: time.Date(2024, 5, 12, 0, 0, 0, 0, time.UTC)}
+	mockDatastore.EXPECT().GetProduct(3, gomock.Any()).DoAndReturn(stored(prod))
+	mockMarkdowns.EXPECT().ListMarkdowns(3).Return([]model.Markdown{
+		{ProductId: 3, Percent: 20, ListPrice: 10, Price: 8, StartsAt: time.Date(2024, 5, 9, 0, 0, 0, 0, time.UTC)},
+	}, nil)
+	mockPricer.EXPECT().Schedule(prod).Return([]model.Markdown{
+		{ProductId: 3, Percent: 20, ListPrice: 10, Price: 8, StartsAt: time.Date(2024, 5, 9, 0, 0, 0, 0, time.UTC)},
+		{ProductId: 3, Percent: 50, ListPrice: 10, Price: 5, StartsAt: time.Date(2024, 5, 11, 0, 0, 0, 0, time.UTC)},
+	})
+	req, _ := http.NewRequest("GET", "/products/3/markdowns", nil)
+	resp := httptest.NewRecorder()
+	myRouter := NewRouter(ctrl)
+	myRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "OK is expected")
+	body := MarkdownsResponse{}
+	json.NewDecoder(resp.Body).Decode(&body)
+	assert.Equal(t, 2, len(body.Scheduled), "both steps are expected")
+	assert.Equal(t, MarkdownResponse{Percent: 50, ListPrice: 10, Price: 5, StartsAt: "2024-05-11T00:00:00Z"}, body.Scheduled[1], "the last step is expected")
+	assert.Equal(t, 1, len(body.History), "the recorded markdown is expected")
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"rest/model"
+	"strconv"
+	"strings"
+)
+
+// WithCategories enables the /categories endpoints
+func WithCategories(categories model.CategoryDatastore) Option {
+	return func(ctrl *Controller) {
+		ctrl.categories = categories
+	}
+}
+
+func (ctrl Controller) ListCat(w http.ResponseWriter, r *http.Request) {
+	categories, err := ctrl.categories.ListCategories()
+	if err != nil {
+		writeError(w, r, err)
+	} else {
+		writeJSON(w, 200, newCategoryResponses(categories))
+	}
+}
+
+// TreeCat returns every category nested under its parent
+func (ctrl Controller) TreeCat(w http.ResponseWriter, r *http.Request) {
+	categories, err := ctrl.categories.ListCategories()
+	if err != nil {
+		writeError(w, r, err)
+	} else {
+		writeJSON(w, 200, newCategoryTree(categories))
+	}
+}
+
+func (ctrl Controller) GetCat(w http.ResponseWriter, r *http.Request) {
+	category := model.Category{}
+	id, err := pathID(r, "id")
+	if err == nil {
+		err = ctrl.categories.GetCategory(id, &category)
+	}
+	if err != nil {
+		writeError(w, r, err)
+	} else {
+		writeJSON(w, 200, newCategoryResponse(category))
+	}
+}
+
+func (ctrl Controller) CreateCat(w http.ResponseWriter, r *http.Request) {
+	body := CategoryRequest{}
+	jsn, _ := ioutil.ReadAll(r.Body)
+	if json.Unmarshal(jsn, &body) != nil {
+		writeProblem(w, r, 400, "request body is not valid JSON")
+		return
+	}
+	category := model.Category{}
+	err := body.toModel(&category)
+	if err == nil {
+		err = ctrl.categories.CreateCategory(&category)
+	}
+	if err != nil {
+		writeError(w, r, err)
+	} else {
+		w.Header().Set("Location", "/categories/"+strconv.Itoa(category.Id))
+		writeJSON(w, 201, newCategoryResponse(category))
+	}
+}
+
+func (ctrl Controller) UpdateCat(w http.ResponseWriter, r *http.Request) {
+	category := model.Category{}
+	id, err := pathID(r, "id")
+	if err == nil {
+		err = ctrl.categories.GetCategory(id, &category)
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	body := CategoryRequest{}
+	jsn, _ := ioutil.ReadAll(r.Body)
+	if json.Unmarshal(jsn, &body) != nil {
+		writeProblem(w, r, 400, "request body is not valid JSON")
+		return
+	}
+	err = body.toModel(&category)
+	if err == nil {
+		err = ctrl.categories.SaveCategory(&category)
+	}
+	if err != nil {
+		writeError(w, r, err)
+	} else {
+		writeJSON(w, 200, newCategoryResponse(category))
+	}
+}
+
+// DeleteCat deletes a category without products, cascade=reassign:<id> moves its products to another category first
+func (ctrl Controller) DeleteCat(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	reassignTo := 0
+	if cascade := r.URL.Query().Get("cascade"); cascade != "" {
+		target, err := strconv.Atoi(strings.TrimPrefix(cascade, "reassign:"))
+		if !strings.HasPrefix(cascade, "reassign:") || err != nil || target < 1 {
+			writeValidation(w, r, ValidationError{Errors: []FieldError{{Field: "cascade", Detail: "cascade must be reassign:<category id>"}}})
+			return
+		}
+		reassignTo = target
+	}
+	if err := ctrl.categories.DeleteCategory(id, reassignTo); err != nil {
+		writeError(w, r, err)
+	} else {
+		writeMessage(w, 200, "deleted successfully")
+	}
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"rest/model"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// productETag is the strong entity tag of a product, it changes with every write
+func productETag(prod model.Product) string {
+	return `"` + strconv.Itoa(prod.Version) + `"`
+}
+
+// pricedETag is the entity tag of a read of prod, a markdown changes the representation without a write
+// so it is part of the tag
+func pricedETag(prod model.Product, markdown float64) string {
+	if markdown == 0 {
+		return productETag(prod)
+	}
+	return `"` + strconv.Itoa(prod.Version) + "-" + strconv.FormatFloat(markdown, 'f', -1, 64) + `"`
+}
+
+// ifMatch reports whether a write may go ahead on prod, requests without If-Match are let through.
+// The tag of a marked down read matches too, writes only depend on the version
+func ifMatch(r *http.Request, prod model.Product) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return true
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || tag == productETag(prod) || strings.HasPrefix(tag, `"`+strconv.Itoa(prod.Version)+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+// writeCacheable sends a read with its validators and Cache-Control, or a bare 304 when the
+// client's copy is still current. An empty etag is derived from the encoded body
+func (ctrl Controller) writeCacheable(w http.ResponseWriter, r *http.Request, etag string, lastModified time.Time, body interface{}) {
+	raw, _ := json.Marshal(body)
+	if etag == "" {
+		sum := sha1.Sum(raw)
+		etag = `"` + hex.EncodeToString(sum[:]) + `"`
+	}
+	w.Header().Set("ETag", etag)
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	if ctrl.cacheControl != "" {
+		w.Header().Set("Cache-Control", ctrl.cacheControl)
+	}
+	if notModified(r, etag, lastModified) {
+		w.WriteHeader(304)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(raw)
+}
+
+// notModified evaluates If-None-Match, or If-Modified-Since when there is no If-None-Match (RFC 7232)
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if header := r.Header.Get("If-None-Match"); header != "" {
+		for _, tag := range strings.Split(header, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+	if header := r.Header.Get("If-Modified-Since"); header != "" && !lastModified.IsZero() {
+		since, err := http.ParseTime(header)
+		return err == nil && !lastModified.Truncate(time.Second).After(since)
+	}
+	return false
+}
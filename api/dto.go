@@ -0,0 +1,681 @@
+package api
+
+import (
+	"regexp"
+	"rest/model"
+	"strings"
+	"time"
+)
+
+// the wire format lives here so the gorm model can change without breaking clients
+
+// ProductCreateRequest is the body of POST /products
+type ProductCreateRequest struct {
+	Name       string  `json:"name"`
+	Price      float32 `json:"price"`
+	Expiry     string  `json:"expiry,omitempty"` // RFC 3339
+	CategoryId int     `json:"categoryId"`
+}
+
+// ProductUpdateRequest is the body of PUT /products/{id}, it replaces every editable field
+type ProductUpdateRequest ProductCreateRequest
+
+// ProductResponse is how a product is represented in every response
+type ProductResponse struct {
+	Id         int     `json:"id"`
+	Name       string  `json:"name"`
+	Price      float32 `json:"price"`
+	Expiry     string  `json:"expiry,omitempty"` // RFC 3339, absent when the product does not expire
+	CategoryId int     `json:"categoryId"`
+	OnHand     int     `json:"onHand"` // stock is read only here, it changes through POST /products/{id}/stock
+	Reserved   int     `json:"reserved"`
+	Available  int     `json:"available"`
+	// with markdown pricing on, the price to charge and the percent taken off the list price for it
+	EffectivePrice *float32 `json:"effectivePrice,omitempty"`
+	Markdown       float64  `json:"markdown,omitempty"`
+}
+
+// StockAdjustmentRequest is the body of POST /products/{id}/stock, the amounts are added to the stock
+type StockAdjustmentRequest struct {
+	LocationId int    `json:"locationId,omitempty"` // absent is the main location
+	OnHand     int    `json:"onHand"`
+	Reserved   int    `json:"reserved"`
+	Reason     string `json:"reason"`
+	Reference  string `json:"reference,omitempty"`
+}
+
+// StockTransferRequest is the body of POST /products/{id}/transfers
+type StockTransferRequest struct {
+	FromLocationId int    `json:"fromLocationId"`
+	ToLocationId   int    `json:"toLocationId"`
+	Quantity       int    `json:"quantity"`
+	Reference      string `json:"reference,omitempty"`
+}
+
+// StockLevelResponse is the stock of a product at one location
+type StockLevelResponse struct {
+	LocationId int `json:"locationId"`
+	OnHand     int `json:"onHand"`
+	Reserved   int `json:"reserved"`
+	Available  int `json:"available"`
+}
+
+// StockTransferResponse shows both locations of a transfer after it
+type StockTransferResponse struct {
+	From StockLevelResponse `json:"from"`
+	To   StockLevelResponse `json:"to"`
+}
+
+// LotRequest is the body of POST /products/{id}/lots
+type LotRequest struct {
+	LotNumber  string `json:"lotNumber"`
+	Quantity   int    `json:"quantity"`
+	Expiry     string `json:"expiry,omitempty"`     // RFC 3339, absent when the lot does not expire
+	ReceivedAt string `json:"receivedAt,omitempty"` // RFC 3339, defaults to now
+	LocationId int    `json:"locationId,omitempty"` // absent is the main location
+	Reference  string `json:"reference,omitempty"`
+}
+
+type LotResponse struct {
+	Id         int    `json:"id"`
+	ProductId  int    `json:"productId"`
+	LotNumber  string `json:"lotNumber"`
+	LocationId int    `json:"locationId"`
+	Quantity   int    `json:"quantity"`
+	Expiry     string `json:"expiry,omitempty"`
+	ReceivedAt string `json:"receivedAt"`
+	ExpiredAt  string `json:"expiredAt,omitempty"` // set once the expiry sweep wrote the lot off
+}
+
+// LotAdjustmentRequest is the body of POST /products/{id}/lots/{lotId}/stock
+type LotAdjustmentRequest struct {
+	Quantity  int    `json:"quantity"`
+	Reason    string `json:"reason"`
+	Reference string `json:"reference,omitempty"`
+}
+
+// AllocationRequest is the body of POST /products/{id}/allocate
+type AllocationRequest struct {
+	Quantity   int    `json:"quantity"`
+	LocationId int    `json:"locationId,omitempty"` // absent picks from every location
+	Reference  string `json:"reference,omitempty"`
+}
+
+type PickResponse struct {
+	LotId      int    `json:"lotId"`
+	LotNumber  string `json:"lotNumber"`
+	LocationId int    `json:"locationId"`
+	Quantity   int    `json:"quantity"`
+	Expiry     string `json:"expiry,omitempty"`
+}
+
+type AllocationResponse struct {
+	ProductId int            `json:"productId"`
+	Quantity  int            `json:"quantity"`
+	Picks     []PickResponse `json:"picks"`
+}
+
+// ExpiringStockResponse is one row of GET /reports/expiring
+type ExpiringStockResponse struct {
+	ProductId   int    `json:"productId"`
+	ProductName string `json:"productName"`
+	CategoryId  int    `json:"categoryId"`
+	LotId       int    `json:"lotId,omitempty"` // absent for stock of a product without lots
+	LotNumber   string `json:"lotNumber,omitempty"`
+	LocationId  int    `json:"locationId"`
+	Quantity    int    `json:"quantity"`
+	Expiry      string `json:"expiry"` // RFC 3339
+}
+
+type MarkdownResponse struct {
+	Percent   float64 `json:"percent"`
+	ListPrice float32 `json:"listPrice"`
+	Price     float32 `json:"price"`
+	StartsAt  string  `json:"startsAt"` // RFC 3339
+}
+
+// MarkdownsResponse is the body of GET /products/{id}/markdowns, history is null unless markdowns are recorded
+type MarkdownsResponse struct {
+	Scheduled []MarkdownResponse `json:"scheduled"`
+	History   []MarkdownResponse `json:"history"`
+}
+
+// LocationRequest is the body of POST /locations
+type LocationRequest struct {
+	Name string `json:"name"`
+	Code string `json:"code"`
+}
+
+type LocationResponse struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+	Code string `json:"code"`
+}
+
+// LocationStockResponse is one product of GET /locations/{id}/products with its stock there
+type LocationStockResponse struct {
+	Product   ProductResponse `json:"product"`
+	OnHand    int             `json:"onHand"`
+	Reserved  int             `json:"reserved"`
+	Available int             `json:"available"`
+}
+
+// StockMovementResponse is one entry of GET /products/{id}/movements
+type StockMovementResponse struct {
+	Id            int    `json:"id"`
+	ProductId     int    `json:"productId"`
+	LocationId    *int   `json:"locationId"` // null on entries older than locations, they belong to the main location
+	LotId         *int   `json:"lotId,omitempty"`
+	Delta         int    `json:"delta"`
+	ReservedDelta int    `json:"reservedDelta"`
+	Reason        string `json:"reason"`
+	Reference     string `json:"reference,omitempty"`
+	TransferId    string `json:"transferId,omitempty"` // shared by both entries of a transfer
+	Actor         string `json:"actor,omitempty"`
+	CreatedAt     string `json:"createdAt"` // RFC 3339
+}
+
+// ProductSearchResult is one hit of GET /products/search
+type ProductSearchResult struct {
+	ProductResponse
+	Score     float64 `json:"score"`
+	Highlight string  `json:"highlight"` // the name with the matching words wrapped in <b></b>
+}
+
+// SuggestionResponse is one completion of GET /products/suggest
+type SuggestionResponse struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// CategoryRequest is the body of POST /categories and PUT /categories/{id}
+type CategoryRequest struct {
+	Name        string `json:"name"`
+	Slug        string `json:"slug,omitempty"` // derived from the name when absent
+	ParentId    *int   `json:"parentId"`
+	Description string `json:"description"`
+}
+
+// CategoryResponse is how a category is represented in every response
+type CategoryResponse struct {
+	Id          int    `json:"id"`
+	Name        string `json:"name"`
+	Slug        string `json:"slug"`
+	ParentId    *int   `json:"parentId"` // null for a top level category
+	Description string `json:"description"`
+}
+
+// CategoryTreeNode is a category of GET /categories/tree with its subcategories
+type CategoryTreeNode struct {
+	CategoryResponse
+	Children []CategoryTreeNode `json:"children"`
+}
+
+// toModel copies the request onto prod and validates the result, a malformed expiry is reported with the other fields
+func (req ProductCreateRequest) toModel(prod *model.Product) error {
+	prod.Name = req.Name
+	prod.Price = req.Price
+	prod.CategoryId = req.CategoryId
+	expiry, expiryErr := parseExpiry(req.Expiry)
+	prod.Expiry = expiry
+
+	var errs []FieldError
+	if err := ValidateForCreate(prod); err != nil {
+		errs = append(errs, err.(ValidationError).Errors...)
+	}
+	if expiryErr != nil {
+		errs = append(errs, *expiryErr)
+	}
+	if len(errs) > 0 {
+		return ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+func (req ProductUpdateRequest) toModel(prod *model.Product) error {
+	return ProductCreateRequest(req).toModel(prod)
+}
+
+func newProductResponse(prod model.Product) ProductResponse {
+	return ProductResponse{
+		Id:         prod.Id,
+		Name:       prod.Name,
+		Price:      prod.Price,
+		Expiry:     formatExpiry(prod.Expiry),
+		CategoryId: prod.CategoryId,
+		OnHand:     prod.OnHand,
+		Reserved:   prod.Reserved,
+		Available:  prod.Available(),
+	}
+}
+
+func newProductResponses(prods []model.Product) []ProductResponse {
+	resp := make([]ProductResponse, len(prods))
+	for i, prod := range prods {
+		resp[i] = newProductResponse(prod)
+	}
+	return resp
+}
+
+func newSearchResults(hits []model.SearchHit) []ProductSearchResult {
+	resp := make([]ProductSearchResult, len(hits))
+	for i, hit := range hits {
+		resp[i] = ProductSearchResult{ProductResponse: newProductResponse(hit.Product), Score: hit.Score, Highlight: hit.Highlight}
+	}
+	return resp
+}
+
+func newSuggestionResponses(suggestions []model.Suggestion) []SuggestionResponse {
+	resp := make([]SuggestionResponse, len(suggestions))
+	for i, suggestion := range suggestions {
+		resp[i] = SuggestionResponse{Id: suggestion.Id, Name: suggestion.Name}
+	}
+	return resp
+}
+
+// shapeProduct keeps only the given fields of a representation, nil keeps the whole of it
+func shapeProduct(resp ProductResponse, fields []string) interface{} {
+	if fields == nil {
+		return resp
+	}
+	all := map[string]interface{}{
+		"id":         resp.Id,
+		"name":       resp.Name,
+		"price":      resp.Price,
+		"expiry":     resp.Expiry,
+		"categoryId": resp.CategoryId,
+		"onHand":     resp.OnHand,
+		"reserved":   resp.Reserved,
+		"available":  resp.Available,
+	}
+	if resp.Expiry == "" {
+		delete(all, "expiry")
+	}
+	if resp.EffectivePrice != nil {
+		all["effectivePrice"] = *resp.EffectivePrice
+	}
+	if resp.Markdown != 0 {
+		all["markdown"] = resp.Markdown
+	}
+	shaped := map[string]interface{}{}
+	for _, field := range fields {
+		if value, ok := all[field]; ok {
+			shaped[field] = value
+		}
+	}
+	return shaped
+}
+
+func shapeProducts(resp []ProductResponse, fields []string) interface{} {
+	if fields == nil {
+		return resp
+	}
+	shaped := make([]interface{}, len(resp))
+	for i, prod := range resp {
+		shaped[i] = shapeProduct(prod, fields)
+	}
+	return shaped
+}
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// toModel copies the request onto c and validates it
+func (req CategoryRequest) toModel(c *model.Category) error {
+	c.Name = strings.TrimSpace(req.Name)
+	c.Slug = req.Slug
+	if c.Slug == "" {
+		c.Slug = slugify(c.Name)
+	}
+	c.ParentId = req.ParentId
+	c.Description = req.Description
+
+	var errs []FieldError
+	if c.Name == "" {
+		errs = append(errs, FieldError{Field: "name", Detail: "name is missing"})
+	}
+	if c.Name != "" && !slugPattern.MatchString(c.Slug) {
+		errs = append(errs, FieldError{Field: "slug", Detail: "slug must be lower case letters and digits separated by single dashes"})
+	}
+	if c.ParentId != nil && *c.ParentId == c.Id {
+		errs = append(errs, FieldError{Field: "parentId", Detail: "a category cannot be its own parent"})
+	}
+	if len(errs) > 0 {
+		return ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+// slugify turns "Dairy & Eggs" into "dairy-eggs"
+func slugify(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	})
+	return strings.Join(words, "-")
+}
+
+func newCategoryResponse(c model.Category) CategoryResponse {
+	return CategoryResponse{
+		Id:          c.Id,
+		Name:        c.Name,
+		Slug:        c.Slug,
+		ParentId:    c.ParentId,
+		Description: c.Description,
+	}
+}
+
+func newCategoryResponses(categories []model.Category) []CategoryResponse {
+	resp := make([]CategoryResponse, len(categories))
+	for i, c := range categories {
+		resp[i] = newCategoryResponse(c)
+	}
+	return resp
+}
+
+// newCategoryTree nests the categories under their parents, the order of the list is kept among siblings
+func newCategoryTree(categories []model.Category) []CategoryTreeNode {
+	children := map[int][]model.Category{}
+	var roots []model.Category
+	for _, c := range categories {
+		if c.ParentId == nil {
+			roots = append(roots, c)
+		} else {
+			children[*c.ParentId] = append(children[*c.ParentId], c)
+		}
+	}
+	var build func([]model.Category) []CategoryTreeNode
+	build = func(level []model.Category) []CategoryTreeNode {
+		nodes := make([]CategoryTreeNode, len(level))
+		for i, c := range level {
+			nodes[i] = CategoryTreeNode{CategoryResponse: newCategoryResponse(c), Children: build(children[c.Id])}
+		}
+		return nodes
+	}
+	return build(roots)
+}
+
+// reasons a client may give for a stock adjustment
+var stockReasons = []string{
+	model.ReasonReceipt, model.ReasonSale, model.ReasonReturn, model.ReasonAdjustment,
+	model.ReasonWriteOff, model.ReasonReservation, model.ReasonRelease,
+}
+
+func (req StockAdjustmentRequest) toModel(productId int, actor string) (model.StockAdjustment, error) {
+	var errs []FieldError
+	if req.OnHand == 0 && req.Reserved == 0 {
+		errs = append(errs, FieldError{Field: "onHand", Detail: "onHand or reserved has to change"})
+	}
+	if !contains(stockReasons, req.Reason) {
+		errs = append(errs, FieldError{Field: "reason", Detail: "reason must be one of " + strings.Join(stockReasons, ", ")})
+	}
+	if len(errs) > 0 {
+		return model.StockAdjustment{}, ValidationError{Errors: errs}
+	}
+	return model.StockAdjustment{
+		ProductId:  productId,
+		LocationId: req.LocationId,
+		OnHand:     req.OnHand,
+		Reserved:   req.Reserved,
+		Reason:     req.Reason,
+		Reference:  req.Reference,
+		Actor:      actor,
+	}, nil
+}
+
+func (req StockTransferRequest) toModel(productId int, actor string) (model.StockTransfer, error) {
+	var errs []FieldError
+	if req.FromLocationId < 1 {
+		errs = append(errs, FieldError{Field: "fromLocationId", Detail: "fromLocationId is missing"})
+	}
+	if req.ToLocationId < 1 {
+		errs = append(errs, FieldError{Field: "toLocationId", Detail: "toLocationId is missing"})
+	} else if req.ToLocationId == req.FromLocationId {
+		errs = append(errs, FieldError{Field: "toLocationId", Detail: "stock cannot be transferred to the location it is at"})
+	}
+	if req.Quantity < 1 {
+		errs = append(errs, FieldError{Field: "quantity", Detail: "quantity must be a positive number"})
+	}
+	if len(errs) > 0 {
+		return model.StockTransfer{}, ValidationError{Errors: errs}
+	}
+	return model.StockTransfer{
+		ProductId:      productId,
+		FromLocationId: req.FromLocationId,
+		ToLocationId:   req.ToLocationId,
+		Quantity:       req.Quantity,
+		Reference:      req.Reference,
+		Actor:          actor,
+	}, nil
+}
+
+func (req LotRequest) toModel(productId int) (model.Lot, error) {
+	lot := model.Lot{ProductId: productId, LotNumber: strings.TrimSpace(req.LotNumber), Quantity: req.Quantity, LocationId: req.LocationId}
+	var errs []FieldError
+	if lot.LotNumber == "" {
+		errs = append(errs, FieldError{Field: "lotNumber", Detail: "lotNumber is missing"})
+	}
+	if lot.Quantity < 1 {
+		errs = append(errs, FieldError{Field: "quantity", Detail: "quantity must be a positive number"})
+	}
+	if req.Expiry != "" {
+		expiry, err := time.Parse(time.RFC3339, req.Expiry)
+		if err != nil {
+			errs = append(errs, FieldError{Field: "expiry", Detail: "expiry must be an RFC 3339 timestamp"})
+		}
+		lot.Expiry = &expiry
+	}
+	if req.ReceivedAt != "" {
+		received, err := time.Parse(time.RFC3339, req.ReceivedAt)
+		if err != nil {
+			errs = append(errs, FieldError{Field: "receivedAt", Detail: "receivedAt must be an RFC 3339 timestamp"})
+		}
+		lot.ReceivedAt = received
+	}
+	if len(errs) > 0 {
+		return model.Lot{}, ValidationError{Errors: errs}
+	}
+	return lot, nil
+}
+
+func (req LotAdjustmentRequest) toModel(productId, lotId int, actor string) (model.LotAdjustment, error) {
+	var errs []FieldError
+	if req.Quantity == 0 {
+		errs = append(errs, FieldError{Field: "quantity", Detail: "quantity has to change"})
+	}
+	if !contains(stockReasons, req.Reason) {
+		errs = append(errs, FieldError{Field: "reason", Detail: "reason must be one of " + strings.Join(stockReasons, ", ")})
+	}
+	if len(errs) > 0 {
+		return model.LotAdjustment{}, ValidationError{Errors: errs}
+	}
+	return model.LotAdjustment{
+		ProductId: productId,
+		LotId:     lotId,
+		Quantity:  req.Quantity,
+		Reason:    req.Reason,
+		Reference: req.Reference,
+		Actor:     actor,
+	}, nil
+}
+
+func newLotResponse(lot model.Lot) LotResponse {
+	resp := LotResponse{
+		Id:         lot.Id,
+		ProductId:  lot.ProductId,
+		LotNumber:  lot.LotNumber,
+		LocationId: lot.LocationId,
+		Quantity:   lot.Quantity,
+		ReceivedAt: lot.ReceivedAt.UTC().Format(time.RFC3339),
+	}
+	if lot.Expiry != nil {
+		resp.Expiry = lot.Expiry.UTC().Format(time.RFC3339)
+	}
+	if lot.ExpiredAt != nil {
+		resp.ExpiredAt = lot.ExpiredAt.UTC().Format(time.RFC3339)
+	}
+	return resp
+}
+
+func newLotResponses(lots []model.Lot) []LotResponse {
+	resp := make([]LotResponse, len(lots))
+	for i, lot := range lots {
+		resp[i] = newLotResponse(lot)
+	}
+	return resp
+}
+
+func (req AllocationRequest) toModel(productId int, actor string) (model.Allocation, error) {
+	if req.Quantity < 1 {
+		return model.Allocation{}, ValidationError{Errors: []FieldError{{Field: "quantity", Detail: "quantity must be a positive number"}}}
+	}
+	return model.Allocation{
+		ProductId:  productId,
+		LocationId: req.LocationId,
+		Quantity:   req.Quantity,
+		Reference:  req.Reference,
+		Actor:      actor,
+	}, nil
+}
+
+func newAllocationResponse(a model.Allocation, picks []model.Pick) AllocationResponse {
+	resp := AllocationResponse{ProductId: a.ProductId, Quantity: a.Quantity, Picks: make([]PickResponse, len(picks))}
+	for i, pick := range picks {
+		resp.Picks[i] = PickResponse{LotId: pick.LotId, LotNumber: pick.LotNumber, LocationId: pick.LocationId, Quantity: pick.Quantity}
+		if pick.Expiry != nil {
+			resp.Picks[i].Expiry = pick.Expiry.UTC().Format(time.RFC3339)
+		}
+	}
+	return resp
+}
+
+func newExpiringStockResponses(stock []model.ExpiringStock) []ExpiringStockResponse {
+	resp := make([]ExpiringStockResponse, len(stock))
+	for i, s := range stock {
+		resp[i] = ExpiringStockResponse{
+			ProductId:   s.ProductId,
+			ProductName: s.ProductName,
+			CategoryId:  s.CategoryId,
+			LotId:       s.LotId,
+			LotNumber:   s.LotNumber,
+			LocationId:  s.LocationId,
+			Quantity:    s.Quantity,
+			Expiry:      s.Expiry.UTC().Format(time.RFC3339),
+		}
+	}
+	return resp
+}
+
+func newMarkdownResponses(markdowns []model.Markdown) []MarkdownResponse {
+	resp := make([]MarkdownResponse, len(markdowns))
+	for i, m := range markdowns {
+		resp[i] = MarkdownResponse{Percent: m.Percent, ListPrice: m.ListPrice, Price: m.Price, StartsAt: m.StartsAt.UTC().Format(time.RFC3339)}
+	}
+	return resp
+}
+
+func newStockLevelResponse(level model.StockLevel) StockLevelResponse {
+	return StockLevelResponse{
+		LocationId: level.LocationId,
+		OnHand:     level.OnHand,
+		Reserved:   level.Reserved,
+		Available:  level.Available(),
+	}
+}
+
+func (req LocationRequest) toModel(l *model.Location) error {
+	l.Name = strings.TrimSpace(req.Name)
+	l.Code = req.Code
+	var errs []FieldError
+	if l.Name == "" {
+		errs = append(errs, FieldError{Field: "name", Detail: "name is missing"})
+	}
+	if !slugPattern.MatchString(l.Code) {
+		errs = append(errs, FieldError{Field: "code", Detail: "code must be lower case letters and digits separated by single dashes"})
+	}
+	if len(errs) > 0 {
+		return ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+func newLocationResponse(l model.Location) LocationResponse {
+	return LocationResponse{Id: l.Id, Name: l.Name, Code: l.Code}
+}
+
+func newLocationResponses(locations []model.Location) []LocationResponse {
+	resp := make([]LocationResponse, len(locations))
+	for i, l := range locations {
+		resp[i] = newLocationResponse(l)
+	}
+	return resp
+}
+
+func newLocationStockResponses(stock []model.LocationStock) []LocationStockResponse {
+	resp := make([]LocationStockResponse, len(stock))
+	for i, s := range stock {
+		resp[i] = LocationStockResponse{
+			Product:   newProductResponse(s.Product),
+			OnHand:    s.Level.OnHand,
+			Reserved:  s.Level.Reserved,
+			Available: s.Level.Available(),
+		}
+	}
+	return resp
+}
+
+func newMovementResponses(movements []model.StockMovement) []StockMovementResponse {
+	resp := make([]StockMovementResponse, len(movements))
+	for i, m := range movements {
+		resp[i] = StockMovementResponse{
+			Id:            m.Id,
+			ProductId:     m.ProductId,
+			LocationId:    m.LocationId,
+			LotId:         m.LotId,
+			Delta:         m.Delta,
+			ReservedDelta: m.ReservedDelta,
+			Reason:        m.Reason,
+			Reference:     m.Reference,
+			TransferId:    m.TransferId,
+			Actor:         m.Actor,
+			CreatedAt:     m.CreatedAt.UTC().Format(time.RFC3339),
+		}
+	}
+	return resp
+}
+
+// changedFields lists the model fields that differ between the stored and the edited product
+func changedFields(before, after model.Product) map[string]interface{} {
+	fields := map[string]interface{}{}
+	if before.Name != after.Name {
+		fields["Name"] = after.Name
+	}
+	if before.Price != after.Price {
+		fields["Price"] = after.Price
+	}
+	if !before.Expiry.Equal(after.Expiry) {
+		fields["Expiry"] = after.Expiry
+	}
+	if before.CategoryId != after.CategoryId {
+		fields["CategoryId"] = after.CategoryId
+	}
+	return fields
+}
+
+// parseExpiry accepts an RFC 3339 timestamp, an empty one means the product does not expire
+func parseExpiry(value string) (time.Time, *FieldError) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	expiry, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, &FieldError{Field: "expiry", Detail: "expiry must be an RFC 3339 timestamp"}
+	}
+	return expiry, nil
+}
+
+// formatExpiry keeps the fraction of a second parseExpiry accepts, so a read written back unchanged is unchanged
+func formatExpiry(expiry time.Time) string {
+	if expiry.IsZero() {
+		return ""
+	}
+	return expiry.UTC().Format(time.RFC3339Nano)
+}
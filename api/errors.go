@@ -0,0 +1,56 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"rest/datastore"
+)
+
+// errorStatus is the one place datastore errors are turned into status codes
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, datastore.ErrNotFound):
+		return 404
+	case errors.Is(err, datastore.ErrConflict), errors.Is(err, datastore.ErrInsufficientStock):
+		return 409
+	case errors.Is(err, datastore.ErrInvalid):
+		return 422
+	case errors.Is(err, datastore.ErrStale):
+		return 412
+	case errors.Is(err, datastore.ErrUnavailable):
+		return 503
+	default:
+		return 500
+	}
+}
+
+// writeError reports any handler error as a problem, unexpected errors are not echoed back to the client
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var verr ValidationError
+	if errors.As(err, &verr) {
+		writeValidation(w, r, verr)
+		return
+	}
+	var perr patchError
+	if errors.As(err, &perr) {
+		writeProblem(w, r, perr.status, perr.detail)
+		return
+	}
+	status := errorStatus(err)
+	if status == 500 {
+		writeProblem(w, r, status, "")
+		return
+	}
+	problem := Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   err.Error(),
+		Instance: r.URL.RequestURI(),
+	}
+	var conflict datastore.ConflictError
+	if errors.As(err, &conflict) {
+		problem.Errors = []FieldError{{Field: conflict.Field, Detail: conflict.Error()}}
+	}
+	writeProblemBody(w, problem)
+}
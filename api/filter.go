@@ -0,0 +1,138 @@
+package api
+
+import (
+	"net/url"
+	"regexp"
+	"rest/model"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// query parameters of GET /products that are not filters
+var listParams = map[string]bool{
+	"sort": true, "order": true, "limit": true, "offset": true, "cursor": true, "count": true,
+	"fields": true, "exclude": true, "includeDescendants": true,
+}
+
+// kinds of value a filter field holds
+const (
+	intValue = iota
+	floatValue
+	stringValue
+	timeValue
+)
+
+type filterField struct {
+	kind int
+	ops  []string
+}
+
+// productFilters is the filter grammar: the fields a listing can be filtered on and their operators
+var productFilters = map[string]filterField{
+	"id":         {kind: intValue, ops: []string{model.OpEq, model.OpNe, model.OpIn, model.OpGt, model.OpGte, model.OpLt, model.OpLte}},
+	"name":       {kind: stringValue, ops: []string{model.OpEq, model.OpNe, model.OpIn, model.OpPrefix}},
+	"price":      {kind: floatValue, ops: []string{model.OpEq, model.OpNe, model.OpGt, model.OpGte, model.OpLt, model.OpLte}},
+	"expiry":     {kind: timeValue, ops: []string{model.OpBefore, model.OpAfter, model.OpGt, model.OpGte, model.OpLt, model.OpLte}},
+	"categoryId": {kind: intValue, ops: []string{model.OpEq, model.OpNe, model.OpIn}},
+}
+
+// filterParam matches field or field[op]
+var filterParam = regexp.MustCompile(`^([A-Za-z]+)(?:\[([a-z]+)\])?$`)
+
+// parseFilters reads every filter parameter, e.g. price[gte]=10&categoryId[in]=1,2&name[prefix]=mil.
+// A bare field=value is an eq filter
+func parseFilters(params url.Values) ([]model.Filter, []FieldError) {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		if !listParams[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var filters []model.Filter
+	var errs []FieldError
+	for _, key := range keys {
+		match := filterParam.FindStringSubmatch(key)
+		if match == nil {
+			errs = append(errs, FieldError{Field: key, Detail: key + " is not a filter, use field or field[operator]"})
+			continue
+		}
+		field, ok := productFilters[match[1]]
+		if !ok {
+			errs = append(errs, FieldError{Field: key, Detail: match[1] + " is not a field that can be filtered on"})
+			continue
+		}
+		op := match[2]
+		if op == "" {
+			op = model.OpEq
+		}
+		if !field.allows(op) {
+			errs = append(errs, FieldError{Field: key, Detail: op + " is not an operator of " + match[1] + ", use one of " + strings.Join(field.ops, ", ")})
+			continue
+		}
+		for _, raw := range params[key] {
+			values := []string{raw}
+			if op == model.OpIn {
+				values = strings.Split(raw, ",")
+			}
+			filter := model.Filter{Field: match[1], Op: op}
+			for _, value := range values {
+				parsed, ok := field.parse(strings.TrimSpace(value))
+				if !ok {
+					errs = append(errs, FieldError{Field: key, Detail: key + " must be " + field.describe()})
+					filter.Values = nil
+					break
+				}
+				filter.Values = append(filter.Values, parsed)
+			}
+			if filter.Values != nil {
+				filters = append(filters, filter)
+			}
+		}
+	}
+	return filters, errs
+}
+
+func (f filterField) allows(op string) bool {
+	for _, allowed := range f.ops {
+		if allowed == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (f filterField) parse(value string) (interface{}, bool) {
+	switch f.kind {
+	case intValue:
+		i, err := strconv.Atoi(value)
+		return i, err == nil
+	case floatValue: // prices are float32, compare with the value a float32 is stored as
+		n, err := strconv.ParseFloat(value, 32)
+		return float64(float32(n)), err == nil
+	case timeValue:
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			return t, true
+		}
+		t, err := time.Parse("2006-01-02", value)
+		return t, err == nil
+	default:
+		return value, value != ""
+	}
+}
+
+func (f filterField) describe() string {
+	switch f.kind {
+	case intValue:
+		return "a whole number"
+	case floatValue:
+		return "a number"
+	case timeValue:
+		return "a date (2006-01-02) or an RFC 3339 timestamp"
+	default:
+		return "a non empty text"
+	}
+}
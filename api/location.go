@@ -0,0 +1,99 @@
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"rest/model"
+	"strconv"
+)
+
+// WithLocations enables the /locations endpoints
+func WithLocations(locations model.LocationDatastore) Option {
+	return func(ctrl *Controller) {
+		ctrl.locations = locations
+	}
+}
+
+func (ctrl Controller) ListLoc(w http.ResponseWriter, r *http.Request) {
+	locations, err := ctrl.locations.ListLocations()
+	if err != nil {
+		writeError(w, r, err)
+	} else {
+		writeJSON(w, 200, newLocationResponses(locations))
+	}
+}
+
+func (ctrl Controller) GetLoc(w http.ResponseWriter, r *http.Request) {
+	location := model.Location{}
+	id, err := pathID(r, "id")
+	if err == nil {
+		err = ctrl.locations.GetLocation(id, &location)
+	}
+	if err != nil {
+		writeError(w, r, err)
+	} else {
+		writeJSON(w, 200, newLocationResponse(location))
+	}
+}
+
+func (ctrl Controller) CreateLoc(w http.ResponseWriter, r *http.Request) {
+	body := LocationRequest{}
+	jsn, _ := ioutil.ReadAll(r.Body)
+	if json.Unmarshal(jsn, &body) != nil {
+		writeProblem(w, r, 400, "request body is not valid JSON")
+		return
+	}
+	location := model.Location{}
+	err := body.toModel(&location)
+	if err == nil {
+		err = ctrl.locations.CreateLocation(&location)
+	}
+	if err != nil {
+		writeError(w, r, err)
+	} else {
+		w.Header().Set("Location", "/locations/"+strconv.Itoa(location.Id))
+		writeJSON(w, 201, newLocationResponse(location))
+	}
+}
+
+// ListLocProducts pages through the products stocked at a location with their stock there, by limit and offset
+func (ctrl Controller) ListLocProducts(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	limit, limitErr := resultLimit(params.Get("limit"))
+	offset, offsetErr := offsetParam(params.Get("offset"))
+	var errs []FieldError
+	for _, err := range []*FieldError{limitErr, offsetErr} {
+		if err != nil {
+			errs = append(errs, *err)
+		}
+	}
+	if len(errs) > 0 {
+		writeValidation(w, r, ValidationError{Errors: errs})
+		return
+	}
+	id, err := pathID(r, "id")
+	if err == nil {
+		err = ctrl.locations.GetLocation(id, &model.Location{})
+	}
+	var stock []model.LocationStock
+	if err == nil {
+		stock, err = ctrl.locations.ListLocationStock(id, limit+1, offset)
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	more := len(stock) > limit
+	if more {
+		stock = stock[:limit]
+	}
+	if links := offsetLinks(r, offset, limit, more); links != "" {
+		w.Header().Set("Link", links)
+	}
+	resp := newLocationStockResponses(stock)
+	for i, s := range stock {
+		resp[i].Product, _ = ctrl.priced(s.Product)
+	}
+	writeJSON(w, 200, resp)
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"rest/model"
+	"strconv"
+)
+
+// WithLots enables the /products/{id}/lots endpoints
+func WithLots(lots model.LotDatastore) Option {
+	return func(ctrl *Controller) {
+		ctrl.lots = lots
+	}
+}
+
+// WithAllocator enables POST /products/{id}/allocate
+func WithAllocator(allocator model.Allocator) Option {
+	return func(ctrl *Controller) {
+		ctrl.allocator = allocator
+	}
+}
+
+// ListLots lists the lots of a product, earliest expiry first
+func (ctrl Controller) ListLots(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err == nil {
+		err = ctrl.datastore.GetProduct(id, &model.Product{})
+	}
+	var lots []model.Lot
+	if err == nil {
+		lots, err = ctrl.lots.ListLots(id)
+	}
+	if err != nil {
+		writeError(w, r, err)
+	} else {
+		writeJSON(w, 200, newLotResponses(lots))
+	}
+}
+
+func (ctrl Controller) GetLot(w http.ResponseWriter, r *http.Request) {
+	lot := model.Lot{}
+	id, err := pathID(r, "id")
+	lotId := 0
+	if err == nil {
+		lotId, err = pathID(r, "lotId")
+	}
+	if err == nil {
+		err = ctrl.lots.GetLot(id, lotId, &lot)
+	}
+	if err != nil {
+		writeError(w, r, err)
+	} else {
+		writeJSON(w, 200, newLotResponse(lot))
+	}
+}
+
+// ReceiveLot books a delivered batch of the product
+func (ctrl Controller) ReceiveLot(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	body := LotRequest{}
+	jsn, _ := ioutil.ReadAll(r.Body)
+	if json.Unmarshal(jsn, &body) != nil {
+		writeProblem(w, r, 400, "request body is not valid JSON")
+		return
+	}
+	lot, err := body.toModel(id)
+	if err == nil {
+		err = ctrl.lots.ReceiveLot(&lot, body.Reference, r.Header.Get("X-Actor"))
+	}
+	if err != nil {
+		writeError(w, r, err)
+	} else {
+		w.Header().Set("Location", "/products/"+strconv.Itoa(id)+"/lots/"+strconv.Itoa(lot.Id))
+		writeJSON(w, 201, newLotResponse(lot))
+	}
+}
+
+// AdjustLot adds units to or takes units from a lot, e.g. for a count correction or a write-off
+func (ctrl Controller) AdjustLot(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	lotId := 0
+	if err == nil {
+		lotId, err = pathID(r, "lotId")
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	body := LotAdjustmentRequest{}
+	jsn, _ := ioutil.ReadAll(r.Body)
+	if json.Unmarshal(jsn, &body) != nil {
+		writeProblem(w, r, 400, "request body is not valid JSON")
+		return
+	}
+	lot := model.Lot{}
+	adj, err := body.toModel(id, lotId, r.Header.Get("X-Actor"))
+	if err == nil {
+		err = ctrl.lots.AdjustLot(adj, &lot)
+	}
+	if err != nil {
+		writeError(w, r, err)
+	} else {
+		writeJSON(w, 200, newLotResponse(lot))
+	}
+}
+
+// Allocate picks units of the product from its lots and answers with the pick list
+func (ctrl Controller) Allocate(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	body := AllocationRequest{}
+	jsn, _ := ioutil.ReadAll(r.Body)
+	if json.Unmarshal(jsn, &body) != nil {
+		writeProblem(w, r, 400, "request body is not valid JSON")
+		return
+	}
+	var picks []model.Pick
+	allocation, err := body.toModel(id, r.Header.Get("X-Actor"))
+	if err == nil {
+		picks, err = ctrl.allocator.Allocate(allocation)
+	}
+	if err != nil {
+		writeError(w, r, err)
+	} else {
+		writeJSON(w, 200, newAllocationResponse(allocation, picks))
+	}
+}
@@ -0,0 +1,325 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// media types accepted by PATCH /products/{id}
+const (
+	mergePatchType = "application/merge-patch+json"
+	jsonPatchType  = "application/json-patch+json"
+)
+
+// patchError is a patch that is well formed but cannot be applied, status is what the client gets
+type patchError struct {
+	status int
+	detail string
+}
+
+func (e patchError) Error() string {
+	return e.detail
+}
+
+func unprocessable(format string, args ...interface{}) error {
+	return patchError{status: 422, detail: fmt.Sprintf(format, args...)}
+}
+
+// mergePatch applies an RFC 7396 merge patch to target, null members remove the field
+func mergePatch(target, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObj, ok := target.(map[string]interface{})
+	if !ok {
+		targetObj = map[string]interface{}{}
+	}
+	for key, val := range patchObj {
+		if val == nil {
+			delete(targetObj, key)
+		} else {
+			targetObj[key] = mergePatch(targetObj[key], val)
+		}
+	}
+	return targetObj
+}
+
+// patchOp is one operation of an RFC 6902 JSON patch
+type patchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"` // nil when the member is absent, "null" when it is null
+}
+
+// jsonPatch applies every operation in order, the first one that fails aborts the whole patch
+func jsonPatch(doc interface{}, ops []patchOp) (interface{}, error) {
+	var err error
+	for i, op := range ops {
+		doc, err = op.apply(doc)
+		if err != nil {
+			if perr, ok := err.(patchError); ok {
+				perr.detail = fmt.Sprintf("operation %d (%s %s): %s", i, op.Op, op.Path, perr.detail)
+				return nil, perr
+			}
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+func (op patchOp) apply(doc interface{}) (interface{}, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, unprocessable("value is missing")
+		}
+		var value interface{}
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return nil, unprocessable("value is not valid JSON")
+		}
+		switch op.Op {
+		case "add":
+			return pointerAdd(doc, path, value)
+		case "replace":
+			if _, err := pointerGet(doc, path); err != nil {
+				return nil, err
+			}
+			if doc, err = pointerRemove(doc, path); err != nil {
+				return nil, err
+			}
+			return pointerAdd(doc, path, value)
+		default:
+			current, err := pointerGet(doc, path)
+			if err != nil {
+				return nil, err
+			}
+			if !reflect.DeepEqual(current, value) {
+				return nil, patchError{status: 409, detail: "test failed"}
+			}
+			return doc, nil
+		}
+	case "remove":
+		return pointerRemove(doc, path)
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		value, err := pointerGet(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "move" {
+			if strings.HasPrefix(op.Path+"/", op.From+"/") && op.Path != op.From {
+				return nil, unprocessable("cannot move a value into itself")
+			}
+			if doc, err = pointerRemove(doc, from); err != nil {
+				return nil, err
+			}
+		} else {
+			value = deepCopy(value)
+		}
+		return pointerAdd(doc, path, value)
+	default:
+		return nil, unprocessable("unknown operation %q", op.Op)
+	}
+}
+
+// parsePointer splits an RFC 6901 JSON pointer into its unescaped reference tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if pointer[0] != '/' {
+		return nil, unprocessable("%q is not a JSON pointer", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+func pointerGet(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			child, ok := node[token]
+			if !ok {
+				return nil, unprocessable("%q does not exist", token)
+			}
+			doc = child
+		case []interface{}:
+			i, err := arrayIndex(token, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, unprocessable("%q does not exist", token)
+		}
+	}
+	return doc, nil
+}
+
+func pointerAdd(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return pointerParent(doc, path, func(parent interface{}, key string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			node[key] = value
+			return node, nil
+		case []interface{}:
+			if key == "-" {
+				return append(node, value), nil
+			}
+			i, err := arrayIndex(key, len(node))
+			if err != nil {
+				return nil, err
+			}
+			node = append(node, nil)
+			copy(node[i+1:], node[i:])
+			node[i] = value
+			return node, nil
+		default:
+			return nil, unprocessable("%q cannot hold members", key)
+		}
+	})
+}
+
+func pointerRemove(doc interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, unprocessable("the whole document cannot be removed")
+	}
+	return pointerParent(doc, path, func(parent interface{}, key string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			if _, ok := node[key]; !ok {
+				return nil, unprocessable("%q does not exist", key)
+			}
+			delete(node, key)
+			return node, nil
+		case []interface{}:
+			i, err := arrayIndex(key, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+			return append(node[:i], node[i+1:]...), nil
+		default:
+			return nil, unprocessable("%q does not exist", key)
+		}
+	})
+}
+
+// pointerParent walks to the container of the last token and lets change rewrite it,
+// arrays may be reallocated so every level stores the child it gets back
+func pointerParent(doc interface{}, path []string, change func(parent interface{}, key string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return change(doc, path[0])
+	}
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		child, ok := node[path[0]]
+		if !ok {
+			return nil, unprocessable("%q does not exist", path[0])
+		}
+		child, err := pointerParent(child, path[1:], change)
+		if err != nil {
+			return nil, err
+		}
+		node[path[0]] = child
+		return node, nil
+	case []interface{}:
+		i, err := arrayIndex(path[0], len(node)-1)
+		if err != nil {
+			return nil, err
+		}
+		child, err := pointerParent(node[i], path[1:], change)
+		if err != nil {
+			return nil, err
+		}
+		node[i] = child
+		return node, nil
+	default:
+		return nil, unprocessable("%q does not exist", path[0])
+	}
+}
+
+// arrayIndex parses an array token, max is the largest index the operation may use
+func arrayIndex(token string, max int) (int, error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i > max || (len(token) > 1 && token[0] == '0') {
+		return 0, unprocessable("%q is not a valid array index", token)
+	}
+	return i, nil
+}
+
+func deepCopy(value interface{}) interface{} {
+	raw, _ := json.Marshal(value)
+	var dup interface{}
+	json.Unmarshal(raw, &dup)
+	return dup
+}
+
+// patchProduct applies a patch of the given media type to the representation of prod
+// and reads the result back as a full replacement of the product
+func patchProduct(mediaType string, patch []byte, prod ProductResponse) (ProductUpdateRequest, error) {
+	raw, _ := json.Marshal(prod)
+	var doc interface{}
+	json.Unmarshal(raw, &doc)
+	if mediaType == mergePatchType {
+		var merge interface{}
+		if json.Unmarshal(patch, &merge) != nil {
+			return ProductUpdateRequest{}, patchError{status: 400, detail: "request body is not a valid merge patch"}
+		}
+		doc = mergePatch(doc, merge)
+	} else {
+		var ops []patchOp
+		if json.Unmarshal(patch, &ops) != nil {
+			return ProductUpdateRequest{}, patchError{status: 400, detail: "request body is not a valid JSON patch"}
+		}
+		var err error
+		if doc, err = jsonPatch(doc, ops); err != nil {
+			return ProductUpdateRequest{}, err
+		}
+	}
+
+	raw, _ = json.Marshal(doc)
+	result := ProductResponse{}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&result); err != nil {
+		return ProductUpdateRequest{}, unprocessable("patched document is not a product: %v", err)
+	}
+	var errs []FieldError
+	if result.Id != prod.Id {
+		errs = append(errs, FieldError{Field: "id", Detail: "id cannot be changed"})
+	}
+	if result.OnHand != prod.OnHand || result.Reserved != prod.Reserved || result.Available != prod.Available {
+		errs = append(errs, FieldError{Field: "onHand", Detail: "stock cannot be patched, adjust it through /products/{id}/stock"})
+	}
+	if !reflect.DeepEqual(result.EffectivePrice, prod.EffectivePrice) || result.Markdown != prod.Markdown {
+		errs = append(errs, FieldError{Field: "effectivePrice", Detail: "effectivePrice is derived from the price and the markdown rules"})
+	}
+	if len(errs) > 0 {
+		return ProductUpdateRequest{}, ValidationError{Errors: errs}
+	}
+	return ProductUpdateRequest{
+		Name:       result.Name,
+		Price:      result.Price,
+		Expiry:     result.Expiry,
+		CategoryId: result.CategoryId,
+	}, nil
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"net/http"
+	"rest/model"
+	"time"
+)
+
+// WithPricing adds the effective price to product reads and enables GET /products/{id}/markdowns
+func WithPricing(pricer model.Pricer) Option {
+	return func(ctrl *Controller) {
+		ctrl.pricer = pricer
+	}
+}
+
+// WithMarkdownHistory adds the recorded markdowns to GET /products/{id}/markdowns
+func WithMarkdownHistory(markdowns model.MarkdownDatastore) Option {
+	return func(ctrl *Controller) {
+		ctrl.markdowns = markdowns
+	}
+}
+
+// priced is the representation of prod with its effective price, and when it last changed: a markdown
+// that took effect after the last write changed it then
+func (ctrl Controller) priced(prod model.Product) (ProductResponse, time.Time) {
+	resp := newProductResponse(prod)
+	modified := prod.UpdatedAt
+	if ctrl.pricer == nil {
+		return resp, modified
+	}
+	price := prod.Price
+	if markdown, ok := ctrl.pricer.Markdown(prod); ok {
+		price = markdown.Price
+		resp.Markdown = markdown.Percent
+		if markdown.StartsAt.After(modified) {
+			modified = markdown.StartsAt
+		}
+	}
+	resp.EffectivePrice = &price
+	return resp, modified
+}
+
+// writeProduct answers a write with the priced representation of prod and its ETag
+func (ctrl Controller) writeProduct(w http.ResponseWriter, status int, prod model.Product) {
+	resp, _ := ctrl.priced(prod)
+	w.Header().Set("ETag", pricedETag(prod, resp.Markdown))
+	writeJSON(w, status, resp)
+}
+
+// loadFields is what to read for a response trimmed to fields: with pricing on the markdown is read too,
+// the ETag depends on it
+func (ctrl Controller) loadFields(fields []string) []string {
+	if fields == nil || ctrl.pricer == nil || contains(fields, "markdown") {
+		return fields
+	}
+	return append(append([]string{}, fields...), "markdown")
+}
+
+// ListMarkdowns shows the markdown schedule of a product and, when it is recorded, its markdown history
+func (ctrl Controller) ListMarkdowns(w http.ResponseWriter, r *http.Request) {
+	prod := model.Product{}
+	id, err := pathID(r, "id")
+	if err == nil {
+		err = ctrl.datastore.GetProduct(id, &prod)
+	}
+	resp := MarkdownsResponse{}
+	if err == nil && ctrl.markdowns != nil {
+		var history []model.Markdown
+		history, err = ctrl.markdowns.ListMarkdowns(id)
+		resp.History = newMarkdownResponses(history)
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	resp.Scheduled = newMarkdownResponses(ctrl.pricer.Schedule(prod))
+	writeJSON(w, 200, resp)
+}
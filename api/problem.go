@@ -0,0 +1,80 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// type of the problems carrying per field errors, every other problem is about:blank
+const validationProblem = "/problems/validation"
+
+// Problem is the RFC 7807 body of every error response
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError is one violation of a request field
+type FieldError struct {
+	Field  string `json:"field"`
+	Detail string `json:"detail"`
+}
+
+// ValidationError collects every field violation of a request instead of stopping at the first
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		msgs[i] = fe.Detail
+	}
+	return strings.Join(msgs, ", ")
+}
+
+// writeProblem sends a plain problem for the status
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	writeProblemBody(w, Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: r.URL.RequestURI(),
+	})
+}
+
+// writeValidation sends a 400 listing every field violation
+func writeValidation(w http.ResponseWriter, r *http.Request, verr ValidationError) {
+	writeProblemBody(w, Problem{
+		Type:     validationProblem,
+		Title:    "Your request parameters didn't validate.",
+		Status:   400,
+		Detail:   verr.Error(),
+		Instance: r.URL.RequestURI(),
+		Errors:   verr.Errors,
+	})
+}
+
+func writeProblemBody(w http.ResponseWriter, problem Problem) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(problem.Status)
+	json.NewEncoder(w).Encode(problem)
+}
+
+// writeJSON sends a successful response
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeMessage sends a successful response that has nothing but a message to say
+func writeMessage(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"message": msg})
+}
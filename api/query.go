@@ -0,0 +1,288 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"rest/model"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// page sizes of GET /products
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// productCursor is what hides behind the opaque cursor parameter
+type productCursor struct {
+	Sort   string   `json:"s"` // the sort the values belong to
+	Values []string `json:"v"` // values of the order keys of the row the page starts after or ends before
+	Before bool     `json:"b,omitempty"`
+}
+
+// parseProductQuery turns the query string of GET /products into a ProductQuery, reporting every bad parameter
+func parseProductQuery(params url.Values) (model.ProductQuery, error) {
+	q := model.ProductQuery{Limit: defaultPageSize}
+	filters, errs := parseFilters(params)
+	q.Filters = filters
+	switch params.Get("includeDescendants") {
+	case "", "false":
+	case "true":
+		for i, f := range q.Filters { // the category filters take in the subtree below each category
+			if f.Field == "categoryId" && (f.Op == model.OpEq || f.Op == model.OpIn) {
+				q.Filters[i].Op = model.OpUnder
+			}
+		}
+	default:
+		errs = append(errs, FieldError{Field: "includeDescendants", Detail: "includeDescendants must be true or false"})
+	}
+
+	sort, sortErrs := parseSort(params.Get("sort"), params.Get("order"))
+	q.Sort = sort
+	errs = append(errs, sortErrs...)
+	fields, fieldErrs := parseFields(params)
+	q.Fields = fields
+	errs = append(errs, fieldErrs...)
+
+	if value := params.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			errs = append(errs, FieldError{Field: "limit", Detail: "limit must be a positive number"})
+		} else if limit > maxPageSize {
+			limit = maxPageSize
+		}
+		q.Limit = limit
+	}
+	offset, offsetErr := offsetParam(params.Get("offset"))
+	if offsetErr != nil {
+		errs = append(errs, *offsetErr)
+	}
+	q.Offset = offset
+	if value := params.Get("cursor"); value != "" {
+		cursor, ok := decodeCursor(value)
+		switch {
+		case !ok || cursor.Sort != sortSpec(q.Sort):
+			errs = append(errs, FieldError{Field: "cursor", Detail: "cursor is invalid or belongs to another sort order"})
+		case params.Get("offset") != "":
+			errs = append(errs, FieldError{Field: "cursor", Detail: "cursor cannot be combined with offset"})
+		case cursor.Before:
+			q.Before = cursor.Values
+		default:
+			q.After = cursor.Values
+		}
+	}
+
+	if len(errs) > 0 {
+		return q, ValidationError{Errors: errs}
+	}
+	return q, nil
+}
+
+// fields a listing can be sorted on
+var sortFields = map[string]bool{"id": true, "name": true, "price": true, "expiry": true, "categoryId": true}
+
+// parseSort reads sort=-price,name: a comma separated list of fields, each descending when prefixed with -.
+// order (asc or desc) sets the direction of the fields without a prefix, for clients of the single key sort
+func parseSort(sort, order string) ([]model.SortKey, []FieldError) {
+	var errs []FieldError
+	desc := false
+	switch order {
+	case "", "asc":
+	case "desc":
+		desc = true
+	default:
+		errs = append(errs, FieldError{Field: "order", Detail: "order must be asc or desc"})
+	}
+	if sort == "" {
+		return nil, errs
+	}
+
+	var keys []model.SortKey
+	seen := map[string]bool{}
+	for _, field := range strings.Split(sort, ",") {
+		key := model.SortKey{Field: strings.TrimSpace(field), Desc: desc}
+		if strings.HasPrefix(key.Field, "-") {
+			key.Field, key.Desc = key.Field[1:], true
+		}
+		switch {
+		case !sortFields[key.Field]:
+			errs = append(errs, FieldError{Field: "sort", Detail: "cannot sort on " + strconv.Quote(key.Field)})
+		case seen[key.Field]:
+			errs = append(errs, FieldError{Field: "sort", Detail: key.Field + " is sorted on twice"})
+		default:
+			seen[key.Field] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys, errs
+}
+
+// fields of a product representation, in the order they are written
+var responseFields = []string{"id", "name", "price", "expiry", "categoryId", "onHand", "reserved", "available", "effectivePrice", "markdown"}
+
+// parseFields reads the sparse fieldset of a product read: fields=id,name keeps only the listed fields,
+// exclude=expiry drops the listed ones. Without either, nil means every field
+func parseFields(params url.Values) ([]string, []FieldError) {
+	include, exclude := params.Get("fields"), params.Get("exclude")
+	if include == "" && exclude == "" {
+		return nil, nil
+	}
+	param, list := "fields", include
+	if exclude != "" {
+		param, list = "exclude", exclude
+	}
+	if include != "" && exclude != "" {
+		return nil, []FieldError{{Field: "fields", Detail: "fields and exclude cannot be combined"}}
+	}
+
+	var errs []FieldError
+	listed := map[string]bool{}
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if !contains(responseFields, field) {
+			errs = append(errs, FieldError{Field: param, Detail: strconv.Quote(field) + " is not a product field"})
+		}
+		listed[field] = true
+	}
+	fields := []string{}
+	for _, field := range responseFields {
+		if listed[field] == (param == "fields") {
+			fields = append(fields, field)
+		}
+	}
+	return fields, errs
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// resultLimit reads the limit of a search or suggestion, it follows the page sizes of the listing
+func resultLimit(value string) (int, *FieldError) {
+	if value == "" {
+		return defaultPageSize, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 {
+		return 0, &FieldError{Field: "limit", Detail: "limit must be a positive number"}
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+	return limit, nil
+}
+
+func offsetParam(value string) (int, *FieldError) {
+	if value == "" {
+		return 0, nil
+	}
+	offset, err := strconv.Atoi(value)
+	if err != nil || offset < 0 {
+		return 0, &FieldError{Field: "offset", Detail: "offset must be zero or a positive number"}
+	}
+	return offset, nil
+}
+
+// sortSpec writes sort keys the way the sort parameter spells them, e.g. "-price,name"
+func sortSpec(keys []model.SortKey) string {
+	spec := make([]string, len(keys))
+	for i, key := range keys {
+		spec[i] = key.Field
+		if key.Desc {
+			spec[i] = "-" + key.Field
+		}
+	}
+	return strings.Join(spec, ",")
+}
+
+func encodeCursor(cursor productCursor) string {
+	raw, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(value string) (productCursor, bool) {
+	cursor := productCursor{}
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || json.Unmarshal(raw, &cursor) != nil || len(cursor.Values) == 0 {
+		return cursor, false
+	}
+	return cursor, true
+}
+
+// cursorAt points just past (or before) prod in the order of q
+func cursorAt(q model.ProductQuery, prod model.Product, before bool) string {
+	var values []string
+	for _, key := range q.OrderKeys() {
+		values = append(values, sortValue(prod, key.Field))
+	}
+	return encodeCursor(productCursor{Sort: sortSpec(q.Sort), Values: values, Before: before})
+}
+
+// sortValue renders a product field so the database can compare it with the column again
+func sortValue(prod model.Product, field string) string {
+	switch field {
+	case "name":
+		return prod.Name
+	case "price":
+		return strconv.FormatFloat(float64(prod.Price), 'f', -1, 64) // the value the numeric column holds, not the shortest float32
+	case "expiry":
+		return prod.Expiry.UTC().Format(time.RFC3339Nano)
+	case "categoryId":
+		return strconv.Itoa(prod.CategoryId)
+	default:
+		return strconv.Itoa(prod.Id)
+	}
+}
+
+// pageLinks builds the Link header of a page. Offset pages link by offset, every other page by cursor.
+// more tells whether rows exist beyond the page in the direction it was read
+func pageLinks(r *http.Request, q model.ProductQuery, prod []model.Product, more bool) string {
+	if r.URL.Query().Get("offset") != "" {
+		return offsetLinks(r, q.Offset, q.Limit, more)
+	}
+	if len(prod) == 0 {
+		return ""
+	}
+	var links []string
+	if (more && q.Before == nil) || q.Before != nil {
+		links = append(links, pageLink(r, "next", "cursor", cursorAt(q, prod[len(prod)-1], false)))
+	}
+	if q.After != nil || (more && q.Before != nil) {
+		links = append(links, pageLink(r, "prev", "cursor", cursorAt(q, prod[0], true)))
+	}
+	return strings.Join(links, ", ")
+}
+
+// offsetLinks links the pages next to an offset page, more tells whether rows exist beyond it
+func offsetLinks(r *http.Request, offset, limit int, more bool) string {
+	var links []string
+	if more {
+		links = append(links, pageLink(r, "next", "offset", strconv.Itoa(offset+limit)))
+	}
+	if offset > 0 {
+		prev := offset - limit
+		if prev < 0 {
+			prev = 0
+		}
+		links = append(links, pageLink(r, "prev", "offset", strconv.Itoa(prev)))
+	}
+	return strings.Join(links, ", ")
+}
+
+// pageLink is the request again with param replacing any offset or cursor
+func pageLink(r *http.Request, rel, param, value string) string {
+	params := r.URL.Query()
+	params.Del("offset")
+	params.Del("cursor")
+	params.Set(param, value)
+	return "<" + r.URL.Path + "?" + params.Encode() + ">; rel=\"" + rel + "\""
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"rest/datastore"
+	"rest/model"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// window of GET /reports/expiring without within
+const defaultExpiryWindow = 7 * 24 * time.Hour
+
+// WithExpiry enables GET /reports/expiring
+func WithExpiry(expiry model.ExpiryDatastore) Option {
+	return func(ctrl *Controller) {
+		ctrl.expiry = expiry
+	}
+}
+
+// ExpiringReport lists the stock that expires within the window, soonest first:
+// GET /reports/expiring?within=7d&categoryId=3
+func (ctrl Controller) ExpiringReport(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	var errs []FieldError
+	within := defaultExpiryWindow
+	if value := params.Get("within"); value != "" {
+		var ok bool
+		if within, ok = parseWindow(value); !ok {
+			errs = append(errs, FieldError{Field: "within", Detail: "within must be a positive duration such as 7d, 12h or 30m"})
+		}
+	}
+	categoryId := 0
+	if value := params.Get("categoryId"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil || id < 1 {
+			errs = append(errs, FieldError{Field: "categoryId", Detail: "categoryId must be a whole number"})
+		}
+		categoryId = id
+	}
+	if len(errs) > 0 {
+		writeValidation(w, r, ValidationError{Errors: errs})
+		return
+	}
+
+	var err error
+	if categoryId != 0 {
+		var exists bool
+		if exists, err = ctrl.datastore.CategoryExists(categoryId); err == nil && !exists {
+			err = fmt.Errorf("%w: category %d does not exist", datastore.ErrNotFound, categoryId)
+		}
+	}
+	var stock []model.ExpiringStock
+	if err == nil {
+		now := ctrl.now()
+		stock, err = ctrl.expiry.ExpiringStock(now, now.Add(within), categoryId)
+	}
+	if err != nil {
+		writeError(w, r, err)
+	} else {
+		writeJSON(w, 200, newExpiringStockResponses(stock))
+	}
+}
+
+// parseWindow reads a Go duration, or a number of days such as 7d
+func parseWindow(value string) (time.Duration, bool) {
+	if days := strings.TrimSuffix(value, "d"); days != value {
+		n, err := strconv.Atoi(days)
+		return time.Duration(n) * 24 * time.Hour, err == nil && n > 0
+	}
+	d, err := time.ParseDuration(value)
+	return d, err == nil && d > 0
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"github.com/gorilla/mux"
+	"net/http"
+	"strings"
+)
+
+// methods we probe when building the Allow header of a 405
+var routeMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE"}
+
+// NewRouter is the single route table of the service, used by main and the tests
+func NewRouter(ctrl Controller) *mux.Router {
+	myRouter := mux.NewRouter().StrictSlash(true)
+	myRouter.HandleFunc("/products", ctrl.ListProd).Methods("GET")
+	myRouter.HandleFunc("/products", ctrl.CreateProd).Methods("POST")
+	if ctrl.searcher != nil {
+		myRouter.HandleFunc("/products/search", ctrl.SearchProd).Methods("GET") // ahead of /products/{id}
+	}
+	if ctrl.suggester != nil {
+		myRouter.HandleFunc("/products/suggest", ctrl.SuggestProd).Methods("GET")
+	}
+	myRouter.HandleFunc("/products/{id}", ctrl.GetProd).Methods("GET")
+	myRouter.HandleFunc("/products/{id}", ctrl.UpdateProd).Methods("PUT")
+	myRouter.HandleFunc("/products/{id}", ctrl.PatchProd).Methods("PATCH")
+	myRouter.HandleFunc("/products/{id}", ctrl.DeleteProd).Methods("DELETE")
+	if ctrl.stock != nil {
+		myRouter.HandleFunc("/products/{id}/stock", ctrl.AdjustStock).Methods("POST")
+		myRouter.HandleFunc("/products/{id}/movements", ctrl.ListMovements).Methods("GET")
+		myRouter.HandleFunc("/products/{id}/transfers", ctrl.TransferStock).Methods("POST")
+	}
+	if ctrl.lots != nil {
+		myRouter.HandleFunc("/products/{id}/lots", ctrl.ListLots).Methods("GET")
+		myRouter.HandleFunc("/products/{id}/lots", ctrl.ReceiveLot).Methods("POST")
+		myRouter.HandleFunc("/products/{id}/lots/{lotId}", ctrl.GetLot).Methods("GET")
+		myRouter.HandleFunc("/products/{id}/lots/{lotId}/stock", ctrl.AdjustLot).Methods("POST")
+	}
+	if ctrl.pricer != nil {
+		myRouter.HandleFunc("/products/{id}/markdowns", ctrl.ListMarkdowns).Methods("GET")
+	}
+	if ctrl.allocator != nil {
+		myRouter.HandleFunc("/products/{id}/allocate", ctrl.Allocate).Methods("POST")
+	}
+	if ctrl.categories != nil {
+		myRouter.HandleFunc("/categories", ctrl.ListCat).Methods("GET")
+		myRouter.HandleFunc("/categories", ctrl.CreateCat).Methods("POST")
+		myRouter.HandleFunc("/categories/tree", ctrl.TreeCat).Methods("GET") // ahead of /categories/{id}
+		myRouter.HandleFunc("/categories/{id}", ctrl.GetCat).Methods("GET")
+		myRouter.HandleFunc("/categories/{id}", ctrl.UpdateCat).Methods("PUT")
+		myRouter.HandleFunc("/categories/{id}", ctrl.DeleteCat).Methods("DELETE")
+	}
+	if ctrl.expiry != nil {
+		myRouter.HandleFunc("/reports/expiring", ctrl.ExpiringReport).Methods("GET")
+	}
+	if ctrl.locations != nil {
+		myRouter.HandleFunc("/locations", ctrl.ListLoc).Methods("GET")
+		myRouter.HandleFunc("/locations", ctrl.CreateLoc).Methods("POST")
+		myRouter.HandleFunc("/locations/{id}", ctrl.GetLoc).Methods("GET")
+		myRouter.HandleFunc("/locations/{id}/products", ctrl.ListLocProducts).Methods("GET")
+	}
+
+	// verb style paths, kept as aliases until every client has moved to /products
+	myRouter.HandleFunc("/create", deprecated("/products", ctrl.CreateProd)).Methods("POST")
+	myRouter.HandleFunc("/get", deprecated("/products", ctrl.ListProd)).Methods("GET")
+	myRouter.HandleFunc("/update/{id}", deprecated("/products/{id}", ctrl.UpdateProd)).Methods("PUT")
+	myRouter.HandleFunc("/delete/{id}", deprecated("/products/{id}", ctrl.DeleteProd)).Methods("DELETE")
+
+	myRouter.MethodNotAllowedHandler = methodNotAllowed(myRouter)
+	return myRouter
+}
+
+// deprecated marks the response of an alias route and points the client at its successor
+func deprecated(successor string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		link := successor
+		for key, val := range mux.Vars(r) {
+			link = strings.Replace(link, "{"+key+"}", val, -1)
+		}
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+link+">; rel=\"successor-version\"")
+		next(w, r)
+	}
+}
+
+// methodNotAllowed answers 405 and lists the methods the path does support
+func methodNotAllowed(router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var allowed []string
+		for _, method := range routeMethods {
+			probe := r.Clone(r.Context())
+			probe.Method = method
+			match := &mux.RouteMatch{}
+			if router.Match(probe, match) && match.MatchErr == nil {
+				allowed = append(allowed, method)
+			}
+		}
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeProblem(w, r, 405, r.Method+" is not supported on "+r.URL.Path)
+	})
+}
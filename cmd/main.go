@@ -1,14 +1,20 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
-	"github.com/gorilla/mux"
 	"github.com/jinzhu/gorm"
-	_ "github.com/jinzhu/gorm/dialects/postgres" // switch dialects to change b/w dbs
+	_ "github.com/jinzhu/gorm/dialects/postgres" // the datastore is written for postgres
 	"log"
 	"net/http"
+	"os"
+	"rest/allocation"
 	"rest/api"
 	"rest/datastore"
+	"rest/expiry"
+	"rest/pricing"
+	"time"
 )
 
 const (
@@ -20,6 +26,12 @@ const (
 )
 
 func main(){
+	cacheControl := flag.String("cache-control", "no-cache", "Cache-Control header sent on product reads")
+	sweepInterval := flag.Duration("sweep-interval", time.Hour, "how often expired stock is written off, 0 turns the sweep off")
+	markdownRules := flag.String("markdown-rules", "", "JSON file of markdown rules, e.g. [{\"days\": 3, \"percent\": 20}]; none turns markdowns off")
+	markdownInterval := flag.Duration("markdown-history-interval", 0, "how often markdowns in effect are recorded, 0 keeps no history")
+	flag.Parse()
+
 	psqlInfo := fmt.Sprintf("host=%s port=%d user=%s "+"password=%s dbname=%s sslmode=disable",host, port, user, password, dbname)
 
 	db, err := gorm.Open("postgres", psqlInfo)
@@ -29,12 +41,48 @@ func main(){
 
 	defer db.Close()
 
-	datastore := datastore.NewProductDataStore(db)
-	ctrl := api.NewController(datastore)
-	myRouter := mux.NewRouter().StrictSlash(true)
-	myRouter.HandleFunc("/delete/{id}",ctrl.DeleteProd).Methods("DELETE")
-	myRouter.HandleFunc("/get",ctrl.ListProd).Methods("GET")
-	myRouter.HandleFunc("/create",ctrl.CreateProd).Methods("POST")
-	myRouter.HandleFunc("/update/{id}",ctrl.UpdateProd).Methods("PUT")
+	if err := datastore.Migrate(db); err != nil {
+		panic(err)
+	}
+
+	searcher := datastore.NewPostgresSearcher(db)
+	categories := datastore.NewCategoryDataStore(db)
+	products := datastore.NewProductDataStore(db)
+	locations := datastore.NewLocationDataStore(db)
+	names, err := datastore.NewNameIndex(products)
+	if err != nil {
+		panic(err)
+	}
+	options := []api.Option{
+		api.WithCacheControl(*cacheControl), api.WithSearcher(searcher), api.WithSuggester(names), api.WithCategories(categories), api.WithStock(products),
+		api.WithLocations(locations), api.WithLots(products),
+		api.WithAllocator(allocation.NewService(products)), api.WithExpiry(products),
+	}
+	if *markdownRules != "" {
+		engine := pricing.NewEngine(loadRules(*markdownRules))
+		options = append(options, api.WithPricing(engine))
+		if *markdownInterval > 0 {
+			options = append(options, api.WithMarkdownHistory(products))
+			go pricing.NewRecorder(products, products, engine).Run(context.Background(), *markdownInterval)
+		}
+	}
+	ctrl := api.NewController(datastore.NewIndexedDatastore(products, names), options...)
+	if *sweepInterval > 0 {
+		go expiry.NewSweeper(products).Run(context.Background(), *sweepInterval)
+	}
+	myRouter := api.NewRouter(ctrl)
 	log.Fatal(http.ListenAndServe(":8080",myRouter))
 }
+
+func loadRules(path string) []pricing.Rule {
+	file, err := os.Open(path)
+	if err != nil {
+		panic(err)
+	}
+	defer file.Close()
+	rules, err := pricing.ParseRules(file)
+	if err != nil {
+		panic(err)
+	}
+	return rules
+}
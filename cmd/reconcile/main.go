@@ -0,0 +1,42 @@
+// Command reconcile recomputes the stock of every product, in total and at each location, from the stock
+// ledger and reports the stock that has drifted from it. It exits with status 1 when there is drift
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/postgres"
+	"log"
+	"os"
+	"rest/datastore"
+)
+
+func main() {
+	dsn := flag.String("dsn", "host=localhost port=5432 user=postgres password=postgres dbname=go_inventory sslmode=disable", "postgres connection string")
+	flag.Parse()
+
+	db, err := gorm.Open("postgres", *dsn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	drifts, err := datastore.NewProductDataStore(db).Reconcile()
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, d := range drifts {
+		where := ""
+		if d.LocationId != 0 {
+			where = fmt.Sprintf(" at location %d", d.LocationId)
+		}
+		fmt.Printf("product %d%s: on hand %d, ledger %d (drift %+d); reserved %d, ledger %d (drift %+d)\n",
+			d.ProductId, where, d.OnHand, d.LedgerOnHand, d.OnHand-d.LedgerOnHand, d.Reserved, d.LedgerReserved, d.Reserved-d.LedgerReserved)
+	}
+	if len(drifts) > 0 {
+		fmt.Printf("%d stock levels drifted from the ledger\n", len(drifts))
+		os.Exit(1)
+	}
+	fmt.Println("stock matches the ledger")
+}
@@ -0,0 +1,137 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"rest/model"
+	"strconv"
+	"strings"
+)
+
+type CategoryDataStore struct {
+	db *gorm.DB
+}
+
+func NewCategoryDataStore(db *gorm.DB) CategoryDataStore {
+	return CategoryDataStore{
+		db: db,
+	}
+}
+
+func (cd CategoryDataStore) CreateCategory(c *model.Category) error {
+	return translate(cd.db.Transaction(func(tx *gorm.DB) error {
+		prefix, err := parentPath(tx, c)
+		if err != nil {
+			return err
+		}
+		if err := tx.Create(c).Error; err != nil {
+			return translate(err)
+		}
+		c.Path = prefix + strconv.Itoa(c.Id) + "/"
+		return translate(tx.Model(c).Update("path", c.Path).Error)
+	}))
+}
+
+func (cd CategoryDataStore) GetCategory(id int, c *model.Category) error {
+	return translate(cd.db.First(c, id).Error)
+}
+
+func (cd CategoryDataStore) ListCategories() ([]model.Category, error) {
+	var categories []model.Category
+	err := cd.db.Order("name").Find(&categories).Error
+	return categories, translate(err)
+}
+
+// SaveCategory writes every field of the category. Moving it to another parent moves its whole subtree,
+// it cannot be moved under one of its own subcategories
+func (cd CategoryDataStore) SaveCategory(c *model.Category) error {
+	return translate(cd.db.Transaction(func(tx *gorm.DB) error {
+		current := model.Category{}
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&current, c.Id).Error; err != nil {
+			return translate(err)
+		}
+		prefix, err := parentPath(tx, c)
+		if err != nil {
+			return err
+		}
+		c.Path = prefix + strconv.Itoa(c.Id) + "/"
+		err = tx.Model(&model.Category{}).Where("id = ?", c.Id).Updates(map[string]interface{}{
+			"Name":        c.Name,
+			"Slug":        c.Slug,
+			"ParentId":    c.ParentId,
+			"Description": c.Description,
+			"Path":        c.Path,
+		}).Error
+		if err != nil || c.Path == current.Path {
+			return translate(err)
+		}
+		err = tx.Exec("UPDATE categories SET path = ? || substr(path, ?) WHERE path LIKE ? AND id <> ?",
+			c.Path, len(current.Path)+1, current.Path+"%", c.Id).Error
+		return translate(err)
+	}))
+}
+
+// DeleteCategory refuses with ErrConflict while products or subcategories still point at the category,
+// unless reassignTo names the category that takes over its products
+func (cd CategoryDataStore) DeleteCategory(id int, reassignTo int) error {
+	return translate(cd.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&model.Category{}, id).Error; err != nil {
+			return translate(err)
+		}
+		if reassignTo != 0 {
+			if reassignTo == id {
+				return fmt.Errorf("%w: products cannot be reassigned to the category being deleted", ErrInvalid)
+			}
+			if err := tx.First(&model.Category{}, reassignTo).Error; gorm.IsRecordNotFoundError(err) {
+				return fmt.Errorf("%w: category %d to reassign to does not exist", ErrInvalid, reassignTo)
+			} else if err != nil {
+				return translate(err)
+			}
+			// a change of each product: stale ETags and If-Modified-Since dates no longer match
+			reassign := map[string]interface{}{"category_id": reassignTo, "version": gorm.Expr("version + 1"), "updated_at": gorm.NowFunc()}
+			if err := tx.Model(&model.Product{}).Where("category_id = ?", id).Updates(reassign).Error; err != nil {
+				return translate(err)
+			}
+		}
+
+		var products, children int
+		if err := tx.Model(&model.Product{}).Where("category_id = ?", id).Count(&products).Error; err != nil {
+			return translate(err)
+		}
+		if err := tx.Model(&model.Category{}).Where("parent_id = ?", id).Count(&children).Error; err != nil {
+			return translate(err)
+		}
+		if products > 0 || children > 0 {
+			return fmt.Errorf("%w: category %d still has %d products and %d subcategories", ErrConflict, id, products, children)
+		}
+		err := tx.Delete(&model.Category{Id: id}).Error
+		if isForeignKeyViolation(err) { // a product was added to it meanwhile
+			return fmt.Errorf("%w: category %d still has products", ErrConflict, id)
+		}
+		return translate(err)
+	}))
+}
+
+// parentPath is the path of the parent of c, which has to exist and must not be c or one of its subcategories
+func parentPath(tx *gorm.DB, c *model.Category) (string, error) {
+	if c.ParentId == nil {
+		return "/", nil
+	}
+	parent := model.Category{}
+	if err := tx.First(&parent, *c.ParentId).Error; gorm.IsRecordNotFoundError(err) {
+		return "", fmt.Errorf("%w: parent category %d does not exist", ErrInvalid, *c.ParentId)
+	} else if err != nil {
+		return "", translate(err)
+	}
+	if c.Id != 0 && strings.Contains(parent.Path, "/"+strconv.Itoa(c.Id)+"/") {
+		return "", fmt.Errorf("%w: category cannot be moved below itself", ErrInvalid)
+	}
+	return parent.Path, nil
+}
+
+func isForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503"
+}
@@ -1,8 +1,10 @@
 package datastore
 
 import (
+	"fmt"
 	"github.com/jinzhu/gorm"
 	"rest/model"
+	"strings"
 )
 
 type ProductDataStore struct {
@@ -16,67 +18,276 @@ func NewProductDataStore(db *gorm.DB) ProductDataStore {
 }
 
 func (pd ProductDataStore) Create(model *model.Product) (err error) {
-	return pd.db.Create(model).Error
+	model.Version = 1
+	return translate(pd.db.Create(model).Error)
 }
 
-func (pd ProductDataStore) Delete(model *model.Product, id string) {
-	pd.db.Delete(model, id)
+// Delete removes the product only if it is still at the version the caller read
+func (pd ProductDataStore) Delete(prod *model.Product) (err error) {
+	db := pd.db.Where("version = ?", prod.Version).Delete(prod)
+	if db.Error != nil {
+		return translate(db.Error)
+	}
+	if db.RowsAffected == 0 {
+		return pd.missingOrStale(prod.Id)
+	}
+	return nil
+}
+
+// Save writes every editable field of the product, see Update
+func (pd ProductDataStore) Save(prod *model.Product) (err error) {
+	return pd.Update(prod, map[string]interface{}{
+		"Name":       prod.Name,
+		"Price":      prod.Price,
+		"Expiry":     prod.Expiry,
+		"CategoryId": prod.CategoryId,
+	})
+}
+
+// Update writes only the given fields of the product. The write is conditional on the version
+// the caller read, so a concurrent change makes it fail with ErrStale instead of being overwritten.
+// A product kept in lots keeps the expiry derived from its lots
+func (pd ProductDataStore) Update(prod *model.Product, fields map[string]interface{}) (err error) {
+	now := gorm.NowFunc()
+	values := map[string]interface{}{"Version": gorm.Expr("version + 1"), "UpdatedAt": now}
+	for key, val := range fields {
+		values[key] = val
+	}
+	expiry, setsExpiry := fields["Expiry"]
+	if setsExpiry {
+		values["Expiry"] = gorm.Expr("CASE WHEN EXISTS (SELECT 1 FROM lots WHERE product_id = products.id) THEN expiry ELSE ? END", expiry)
+	}
+	db := pd.db.Model(&model.Product{}).Where("id = ? AND version = ?", prod.Id, prod.Version).Updates(values)
+	if db.Error != nil {
+		return translate(db.Error)
+	}
+	if db.RowsAffected == 0 {
+		return pd.missingOrStale(prod.Id)
+	}
+	prod.Version++
+	prod.UpdatedAt = now
+	if setsExpiry {
+		written := model.Product{}
+		if err := pd.db.Select("expiry").First(&written, prod.Id).Error; err != nil {
+			return translate(err)
+		}
+		prod.Expiry = written.Expiry
+	}
+	return nil
 }
 
-func (pd ProductDataStore) Save(model *model.Product) (err error) {
-	return pd.db.Save(model).Error
+// missingOrStale explains why a conditional write touched no row
+func (pd ProductDataStore) missingOrStale(id int) error {
+	var count int
+	if err := pd.db.Model(&model.Product{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		return translate(err)
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+	return ErrStale
 }
 
+// columns a listing can be filtered, ordered and paged on, keyed by api field name
+var productColumns = map[string]string{
+	"id":         "id",
+	"name":       "name",
+	"price":      "price",
+	"expiry":     "expiry",
+	"categoryId": "category_id",
+	"onHand":     "on_hand",
+	"reserved":   "reserved",
+}
 
-func (pd ProductDataStore) GetCategorisedProducts(params map[string][]string) []model.Product{
+// GetCategorisedProducts returns one page of products. Pages are either offset based or keyset based:
+// After and Before hold the values of the order keys of a row and the page continues right after or stops
+// right before it, which stays stable while rows are inserted or deleted
+func (pd ProductDataStore) GetCategorisedProducts(q model.ProductQuery) ([]model.Product, error){
 	var prod []model.Product
-	id, cat_ok := params["categoryId"]
-	var db *gorm.DB
-	if cat_ok{
-		db = pd.db.Where("category_id = ?", id[0])
-	}
-	sort, sort_ok := params["sort"]
-	if sort_ok{
-		_, ord_ok := params["order"]
-		if sort[0] == "price"{
-			if ord_ok{
-				if cat_ok{
-					db = db.Order("price desc")
-				}else{
-					db = pd.db.Order("price desc")
-				}
-			}else{
-				if cat_ok{
-					db = db.Order("price")
-				}else{
-					db = pd.db.Order("price")
-				}
-			}
-		}else{
-			if ord_ok{
-				if cat_ok{
-					db = db.Order("expiry desc")
-				}else{
-					db = pd.db.Order("expiry desc")
-				}
-			}else{
-				if cat_ok{
-					db = db.Order("expiry")
-				}else{
-					db = pd.db.Order("expiry")
-				}
-			}
+	keys := q.OrderKeys()
+	cursor, backwards := q.After, false
+	if q.Before != nil {
+		cursor, backwards = q.Before, true
+		for i := range keys { // walk towards the start, the page is flipped back below
+			keys[i].Desc = !keys[i].Desc
+		}
+	}
+
+	db, err := pd.filter(q)
+	if err != nil {
+		return nil, err
+	}
+	if q.Fields != nil {
+		columns, err := selectColumns(q.Fields, keys)
+		if err != nil {
+			return nil, err
+		}
+		db = db.Select(columns)
+	}
+	for _, key := range keys {
+		column, ok := productColumns[key.Field]
+		if !ok {
+			return nil, fmt.Errorf("%w: cannot sort on %s", ErrInvalid, key.Field)
+		}
+		if key.Desc {
+			column += " desc"
+		}
+		db = db.Order(column)
+	}
+	if cursor != nil {
+		cond, args, err := keysetCondition(keys, cursor)
+		if err != nil {
+			return nil, err
+		}
+		db = db.Where(cond, args...)
+	}
+	if q.Offset > 0 {
+		db = db.Offset(q.Offset)
+	}
+	if q.Limit > 0 {
+		db = db.Limit(q.Limit)
+	}
+	if err := db.Find(&prod).Error; err != nil {
+		return nil, translate(err)
+	}
+	if backwards {
+		for i, j := 0, len(prod)-1; i < j; i, j = i+1, j-1 {
+			prod[i], prod[j] = prod[j], prod[i]
+		}
+	}
+	return prod, nil
+}
+
+// selectColumns lists the columns a projected read loads: the requested fields, the order keys
+// the cursors are built from and updated_at for the Last-Modified of a single product
+func selectColumns(fields []string, keys []model.SortKey) ([]string, error) {
+	columns := []string{"updated_at"}
+	seen := map[string]bool{}
+	wanted := append([]string{}, fields...)
+	for _, key := range keys {
+		wanted = append(wanted, key.Field)
+	}
+	for i := 0; i < len(wanted); i++ {
+		field := wanted[i]
+		if field == "available" { // computed from the stock columns
+			wanted = append(wanted, "onHand", "reserved")
+			continue
+		}
+		if field == "effectivePrice" || field == "markdown" { // computed by the pricing rules
+			wanted = append(wanted, "price", "expiry", "categoryId")
+			continue
 		}
+		column, ok := productColumns[field]
+		if !ok {
+			return nil, fmt.Errorf("%w: cannot select %s", ErrInvalid, field)
+		}
+		if !seen[column] {
+			seen[column] = true
+			columns = append(columns, column)
+		}
+	}
+	return columns, nil
+}
+
+// CountProducts counts every product the query matches, ignoring paging
+func (pd ProductDataStore) CountProducts(q model.ProductQuery) (int, error) {
+	var count int
+	db, err := pd.filter(q)
+	if err != nil {
+		return 0, err
 	}
-	if cat_ok || sort_ok{
-		db = db.Find(&prod)
-	}else{
-		db=pd.db.Find(&prod)
+	err = db.Model(&model.Product{}).Count(&count).Error
+	return count, translate(err)
+}
+
+// SQL of each filter operator, the value is always bound as a parameter
+var filterOperators = map[string]string{
+	model.OpEq:     " = ?",
+	model.OpNe:     " <> ?",
+	model.OpGt:     " > ?",
+	model.OpGte:    " >= ?",
+	model.OpLt:     " < ?",
+	model.OpLte:    " <= ?",
+	model.OpBefore: " < ?",
+	model.OpAfter:  " > ?",
+	model.OpIn:     " IN (?)",
+	model.OpPrefix: ` LIKE ? ESCAPE '\'`,
+	model.OpUnder:  ` IN (SELECT c.id FROM categories c JOIN categories root ON c.path LIKE root.path || '%' WHERE root.id IN (?))`,
+}
+
+// filter narrows the products down to the ones the query asks for
+func (pd ProductDataStore) filter(q model.ProductQuery) (*gorm.DB, error) {
+	db := pd.db
+	for _, f := range q.Filters {
+		cond, arg, err := filterCondition(f)
+		if err != nil {
+			return nil, err
+		}
+		db = db.Where(cond, arg)
 	}
-	//fmt.Println(prod)
-	return prod
+	return db, nil
 }
 
-func (pd ProductDataStore) GetProductForUpdate(query string,id string,prod *model.Product)(err error){
-	return pd.db.Where(query,id).Find(prod).Error
-}
\ No newline at end of file
+// filterCondition turns a filter into a WHERE clause. Fields and operators are looked up in
+// whitelists and values are always bound, so nothing from the request becomes part of the SQL text
+func filterCondition(f model.Filter) (string, interface{}, error) {
+	column, ok := productColumns[f.Field]
+	op, known := filterOperators[f.Op]
+	if !ok || !known || len(f.Values) == 0 {
+		return "", nil, fmt.Errorf("%w: cannot filter %s with %s", ErrInvalid, f.Field, f.Op)
+	}
+	switch f.Op {
+	case model.OpIn, model.OpUnder:
+		return column + op, f.Values, nil
+	case model.OpPrefix:
+		return column + op, likeEscaper.Replace(fmt.Sprint(f.Values[0])) + "%", nil
+	default:
+		return column + op, f.Values[0], nil
+	}
+}
+
+// likeEscaper makes LIKE wildcards in a prefix match literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// keysetCondition selects the rows that sort after values: (a > ?) OR (a = ? AND b > ?) OR ...
+func keysetCondition(keys []model.SortKey, values []string) (string, []interface{}, error) {
+	if len(values) != len(keys) {
+		return "", nil, fmt.Errorf("%w: cursor does not match the sort order", ErrInvalid)
+	}
+	var ors []string
+	var args []interface{}
+	for i, key := range keys {
+		var ands []string
+		for j := 0; j < i; j++ {
+			ands = append(ands, productColumns[keys[j].Field]+" = ?")
+			args = append(args, values[j])
+		}
+		op := " > ?"
+		if key.Desc {
+			op = " < ?"
+		}
+		ands = append(ands, productColumns[key.Field]+op)
+		args = append(args, values[i])
+		ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+	}
+	return strings.Join(ors, " OR "), args, nil
+}
+
+func (pd ProductDataStore) GetProduct(id int, prod *model.Product) (err error) {
+	return translate(pd.db.First(prod, id).Error)
+}
+
+// GetProductFields loads the columns of the fields only, plus the version the ETag is built from
+func (pd ProductDataStore) GetProductFields(id int, fields []string, prod *model.Product) error {
+	columns, err := selectColumns(fields, []model.SortKey{{Field: "id"}})
+	if err != nil {
+		return err
+	}
+	return translate(pd.db.Select(append(columns, "version")).First(prod, id).Error)
+}
+
+func (pd ProductDataStore) CategoryExists(id int) (bool, error) {
+	var count int
+	err := pd.db.Model(&model.Category{}).Where("id = ?", id).Count(&count).Error
+	return count > 0, translate(err)
+}
@@ -0,0 +1,79 @@
+package datastore
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"rest/model"
+	"testing"
+)
+
+func TestKeysetCondition(t *testing.T) {
+
+	keys := []model.SortKey{{Field: "price", Desc: true}, {Field: "name"}, {Field: "id"}}
+	cond, args, err := keysetCondition(keys, []string{"10", "milk", "4"})
+
+	assert.Nil(t, err, "no error is expected")
+	assert.Equal(t, "(price < ?) OR (price = ? AND name > ?) OR (price = ? AND name = ? AND id > ?)", cond, "keyset condition is expected")
+	assert.Equal(t, []interface{}{"10", "10", "milk", "10", "milk", "4"}, args, "keyset arguments are expected")
+}
+
+func TestKeysetConditionWithWrongCursor(t *testing.T) {
+
+	_, _, err := keysetCondition([]model.SortKey{{Field: "id"}}, []string{"10", "4"})
+
+	assert.True(t, errors.Is(err, ErrInvalid), "ErrInvalid is expected")
+}
+
+func TestFilterCondition(t *testing.T) {
+
+	cond, arg, err := filterCondition(model.Filter{Field: "categoryId", Op: model.OpIn, Values: []interface{}{1, 2}})
+	assert.Nil(t, err, "no error is expected")
+	assert.Equal(t, "category_id IN (?)", cond, "in condition is expected")
+	assert.Equal(t, []interface{}{1, 2}, arg, "every value is expected")
+
+	cond, arg, err = filterCondition(model.Filter{Field: "price", Op: model.OpGte, Values: []interface{}{10.5}})
+	assert.Nil(t, err, "no error is expected")
+	assert.Equal(t, "price >= ?", cond, "gte condition is expected")
+	assert.Equal(t, 10.5, arg, "value is expected")
+}
+
+func TestFilterConditionEscapesPrefix(t *testing.T) {
+
+	cond, arg, err := filterCondition(model.Filter{Field: "name", Op: model.OpPrefix, Values: []interface{}{`50%_off\`}})
+
+	assert.Nil(t, err, "no error is expected")
+	assert.Equal(t, `name LIKE ? ESCAPE '\'`, cond, "like condition is expected")
+	assert.Equal(t, `50\%\_off\\%`, arg, "wildcards are expected to be escaped")
+}
+
+func TestFilterConditionWithUnknownField(t *testing.T) {
+
+	_, _, err := filterCondition(model.Filter{Field: "name; drop table products", Op: model.OpEq, Values: []interface{}{"x"}})
+
+	assert.True(t, errors.Is(err, ErrInvalid), "ErrInvalid is expected")
+}
+
+func TestSelectColumns(t *testing.T) {
+
+	columns, err := selectColumns([]string{"name", "categoryId"}, []model.SortKey{{Field: "price"}, {Field: "id"}})
+
+	assert.Nil(t, err, "no error is expected")
+	assert.Equal(t, []string{"updated_at", "name", "category_id", "price", "id"}, columns, "fields and order keys are expected")
+}
+
+func TestFilterConditionForSubtree(t *testing.T) {
+
+	cond, arg, err := filterCondition(model.Filter{Field: "categoryId", Op: model.OpUnder, Values: []interface{}{5}})
+
+	assert.Nil(t, err, "no error is expected")
+	assert.Equal(t, "category_id IN (SELECT c.id FROM categories c JOIN categories root ON c.path LIKE root.path || '%' WHERE root.id IN (?))", cond, "subtree condition is expected")
+	assert.Equal(t, []interface{}{5}, arg, "category ids are expected")
+}
+
+func TestSelectColumnsForAvailableStock(t *testing.T) {
+
+	columns, err := selectColumns([]string{"onHand", "available"}, []model.SortKey{{Field: "id"}})
+
+	assert.Nil(t, err, "no error is expected")
+	assert.Equal(t, []string{"updated_at", "on_hand", "id", "reserved"}, columns, "stock columns are expected once")
+}
@@ -0,0 +1,81 @@
+package datastore
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"net"
+	"strings"
+)
+
+// errors returned by the datastores, whatever database sits behind them
+var (
+	ErrNotFound          = errors.New("record not found")
+	ErrConflict          = errors.New("record conflicts with an existing one")
+	ErrUnavailable       = errors.New("datastore is unavailable")
+	ErrInvalid           = errors.New("record is invalid")
+	ErrStale             = errors.New("record was changed since it was read")
+	ErrInsufficientStock = errors.New("not enough stock")
+)
+
+// ConflictError names the field whose value is already taken, it matches ErrConflict with errors.Is
+type ConflictError struct {
+	Field string
+}
+
+func (e ConflictError) Error() string {
+	return e.Field + " already exists"
+}
+
+func (e ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// translate maps gorm and Postgres driver errors onto the errors above, anything unknown is passed through.
+// Postgres is the only backend: the datastore relies on its SQL (ON CONFLICT, NULLS LAST, full-text
+// search), another one would need its driver errors mapped here too
+func translate(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errs, ok := err.(gorm.Errors); ok && len(errs) > 0 {
+		err = errs[0]
+	}
+	if gorm.IsRecordNotFoundError(err) || errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch {
+		case pqErr.Code == "23505": // unique_violation
+			return ConflictError{Field: conflictField(pqErr)}
+		case pqErr.Code.Class() == "23" || pqErr.Code.Class() == "22": // integrity and data exceptions
+			return fmt.Errorf("%w: %s", ErrInvalid, pqErr.Message)
+		case pqErr.Code.Class() == "08" || pqErr.Code.Class() == "53" || pqErr.Code.Class() == "57": // connection, resources, shutdown
+			return fmt.Errorf("%w: %s", ErrUnavailable, pqErr.Message)
+		}
+		return err
+	}
+	var netErr net.Error
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) || errors.As(err, &netErr) {
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	return err
+}
+
+// conflictField reads the column out of postgres' "Key (name)=(prod1) already exists." detail
+func conflictField(pqErr *pq.Error) string {
+	if start := strings.Index(pqErr.Detail, "Key ("); start >= 0 {
+		rest := pqErr.Detail[start+len("Key ("):]
+		if end := strings.Index(rest, ")="); end >= 0 {
+			return rest[:end]
+		}
+	}
+	if pqErr.Column != "" {
+		return pqErr.Column
+	}
+	return pqErr.Constraint
+}
@@ -0,0 +1,44 @@
+package datastore
+
+import (
+	"database/sql/driver"
+	"errors"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestTranslateDuplicateKey(t *testing.T) {
+
+	err := translate(&pq.Error{Code: "23505", Detail: "Key (name)=(prod1) already exists."})
+
+	assert.True(t, errors.Is(err, ErrConflict), "ErrConflict is expected")
+	assert.Equal(t, ConflictError{Field: "name"}, err, "conflicting field is expected")
+}
+
+func TestTranslateNotFound(t *testing.T) {
+
+	assert.Equal(t, ErrNotFound, translate(gorm.ErrRecordNotFound), "ErrNotFound is expected")
+	assert.Equal(t, ErrNotFound, translate(gorm.Errors{gorm.ErrRecordNotFound}), "ErrNotFound is expected")
+}
+
+func TestTranslateInvalid(t *testing.T) {
+
+	assert.True(t, errors.Is(translate(&pq.Error{Code: "23502"}), ErrInvalid), "not null violation is expected to be ErrInvalid")
+	assert.True(t, errors.Is(translate(&pq.Error{Code: "22001"}), ErrInvalid), "data exception is expected to be ErrInvalid")
+}
+
+func TestTranslateUnavailable(t *testing.T) {
+
+	assert.True(t, errors.Is(translate(&pq.Error{Code: "08006"}), ErrUnavailable), "connection failure is expected to be ErrUnavailable")
+	assert.True(t, errors.Is(translate(driver.ErrBadConn), ErrUnavailable), "bad connection is expected to be ErrUnavailable")
+}
+
+func TestTranslatePassesUnknownErrors(t *testing.T) {
+
+	err := errors.New("something else")
+
+	assert.Equal(t, err, translate(err), "unknown errors are expected untouched")
+	assert.Nil(t, translate(nil), "nil is expected to stay nil")
+}
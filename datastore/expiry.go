@@ -0,0 +1,137 @@
+package datastore
+
+import (
+	"github.com/jinzhu/gorm"
+	"rest/model"
+	"time"
+)
+
+func (pd ProductDataStore) ExpiringStock(from, until time.Time, categoryId int) ([]model.ExpiringStock, error) {
+	lots := `SELECT l.product_id, p.name AS product_name, p.category_id, l.id AS lot_id, l.lot_number, l.location_id,
+			l.quantity, l.expiry
+		FROM lots l JOIN products p ON p.id = l.product_id
+		WHERE l.quantity > 0 AND l.expired_at IS NULL AND l.expiry > ? AND l.expiry <= ?`
+	levels := `SELECT s.product_id, p.name, p.category_id, 0, '', s.location_id, s.on_hand, p.expiry
+		FROM stock_levels s JOIN products p ON p.id = s.product_id
+		WHERE s.on_hand > 0 AND p.expiry > ? AND p.expiry <= ? AND NOT EXISTS (SELECT 1 FROM lots l WHERE l.product_id = p.id)`
+	args := []interface{}{from, until}
+	if categoryId != 0 {
+		under := " AND p.category_id" + filterOperators[model.OpUnder]
+		lots += under
+		levels += under
+		args = append(args, []int{categoryId})
+	}
+	var stock []model.ExpiringStock
+	err := pd.db.Raw(lots+" UNION ALL "+levels+" ORDER BY expiry, product_id, lot_id, location_id",
+		append(args, args...)...).Scan(&stock).Error
+	return stock, translate(err)
+}
+
+// WriteOffExpired gives every lot and stock level its own transaction, so one that fails does not hold
+// back the others; it is written off on the next sweep. Only write-offs of units make an event
+func (pd ProductDataStore) WriteOffExpired(now time.Time, actor string) ([]model.ExpiryEvent, error) {
+	var lots []model.Lot
+	if err := pd.db.Where("expired_at IS NULL AND expiry <= ?", now).Order("id").Find(&lots).Error; err != nil {
+		return nil, translate(err)
+	}
+	var events []model.ExpiryEvent
+	for _, expired := range lots {
+		lot := model.Lot{}
+		var quantity int
+		err := pd.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Set("gorm:query_option", "FOR UPDATE").Where("expired_at IS NULL").First(&lot, expired.Id).Error; err != nil {
+				return err
+			}
+			if lot.Quantity > 0 {
+				var err error
+				if quantity, err = writeOff(tx, lot.ProductId, lot.LocationId, &lot.Id, lot.Quantity, "expired lot "+lot.LotNumber, actor); err != nil {
+					return err
+				}
+			}
+			// units the stock level did not hold stay on the lot, it is expired all the same
+			if err := tx.Model(&lot).Updates(map[string]interface{}{"quantity": lot.Quantity - quantity, "expired_at": now}).Error; err != nil {
+				return err
+			}
+			return deriveExpiry(tx, lot.ProductId)
+		})
+		if gorm.IsRecordNotFoundError(err) { // swept meanwhile
+			continue
+		}
+		if err != nil {
+			return events, translate(err)
+		}
+		if quantity == 0 { // emptied before it expired, nothing was written off
+			continue
+		}
+		events = append(events, model.ExpiryEvent{ProductId: lot.ProductId, LotId: lot.Id, LocationId: lot.LocationId,
+			Quantity: quantity, Expiry: *lot.Expiry, SweptAt: now})
+	}
+
+	var levels []model.StockLevel
+	err := pd.db.Table("stock_levels").Select("stock_levels.*").
+		Joins("JOIN products p ON p.id = stock_levels.product_id").
+		Where("stock_levels.on_hand > 0 AND p.expiry > ? AND p.expiry <= ?", time.Time{}, now).
+		Where("NOT EXISTS (SELECT 1 FROM lots l WHERE l.product_id = p.id)").
+		Order("stock_levels.product_id").Order("stock_levels.location_id").Find(&levels).Error
+	if err != nil {
+		return events, translate(err)
+	}
+	for _, level := range levels {
+		prod := model.Product{}
+		expired := false
+		var quantity int
+		err := pd.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&prod, level.ProductId).Error; err != nil {
+				return err
+			}
+			if expired = !prod.Expiry.IsZero() && !prod.Expiry.After(now); !expired { // given a new expiry meanwhile
+				return nil
+			}
+			var err error
+			quantity, err = writeOff(tx, level.ProductId, level.LocationId, nil, level.OnHand, "expired", actor)
+			return err
+		})
+		if gorm.IsRecordNotFoundError(err) || (err == nil && (!expired || quantity == 0)) {
+			continue
+		}
+		if err != nil {
+			return events, translate(err)
+		}
+		events = append(events, model.ExpiryEvent{ProductId: level.ProductId, LocationId: level.LocationId,
+			Quantity: quantity, Expiry: prod.Expiry, SweptAt: now})
+	}
+	return events, nil
+}
+
+// writeOff takes up to quantity units out of the stock at the location, releasing as many reservations as
+// it takes to keep the reserved units covered by the units left. It tells how many units it took
+func writeOff(tx *gorm.DB, productId, locationId int, lotId *int, quantity int, reference, actor string) (int, error) {
+	level := model.StockLevel{}
+	err := tx.Set("gorm:query_option", "FOR UPDATE").
+		Where("product_id = ? AND location_id = ?", productId, locationId).First(&level).Error
+	if err != nil {
+		return 0, translate(err)
+	}
+	if quantity > level.OnHand {
+		quantity = level.OnHand
+	}
+	release := level.Reserved - (level.OnHand - quantity)
+	if release < 0 {
+		release = 0
+	}
+	if quantity == 0 && release == 0 {
+		return 0, nil
+	}
+	adj := model.StockAdjustment{
+		ProductId: productId,
+		OnHand:    -quantity,
+		Reserved:  -release,
+		Reason:    model.ReasonWriteOff,
+		Reference: reference,
+		Actor:     actor,
+	}
+	if err := applyAdjustment(tx, adj, locationId, lotId, &model.Product{}); err != nil {
+		return 0, err
+	}
+	return quantity, nil
+}
@@ -0,0 +1,63 @@
+package datastore
+
+import (
+	"github.com/jinzhu/gorm"
+	"rest/model"
+)
+
+type LocationDataStore struct {
+	db *gorm.DB
+}
+
+func NewLocationDataStore(db *gorm.DB) LocationDataStore {
+	return LocationDataStore{
+		db: db,
+	}
+}
+
+func (ld LocationDataStore) CreateLocation(l *model.Location) error {
+	return translate(ld.db.Create(l).Error)
+}
+
+func (ld LocationDataStore) GetLocation(id int, l *model.Location) error {
+	return translate(ld.db.First(l, id).Error)
+}
+
+func (ld LocationDataStore) ListLocations() ([]model.Location, error) {
+	var locations []model.Location
+	err := ld.db.Order("name").Find(&locations).Error
+	return locations, translate(err)
+}
+
+// ListLocationStock lists the products that have, or had, stock at the location
+func (ld LocationDataStore) ListLocationStock(locationId int, limit, offset int) ([]model.LocationStock, error) {
+	var levels []model.StockLevel
+	db := ld.db.Table("stock_levels").Select("stock_levels.*").
+		Joins("JOIN products ON products.id = stock_levels.product_id").
+		Where("stock_levels.location_id = ?", locationId).
+		Order("products.name").Order("products.id").Offset(offset)
+	if limit > 0 {
+		db = db.Limit(limit)
+	}
+	if err := db.Find(&levels).Error; err != nil {
+		return nil, translate(err)
+	}
+
+	ids := make([]int, len(levels))
+	for i, level := range levels {
+		ids[i] = level.ProductId
+	}
+	var products []model.Product
+	if err := ld.db.Where("id IN (?)", ids).Find(&products).Error; err != nil {
+		return nil, translate(err)
+	}
+	byId := map[int]model.Product{}
+	for _, prod := range products {
+		byId[prod.Id] = prod
+	}
+	stock := make([]model.LocationStock, len(levels))
+	for i, level := range levels {
+		stock[i] = model.LocationStock{Product: byId[level.ProductId], Level: level}
+	}
+	return stock, nil
+}
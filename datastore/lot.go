@@ -0,0 +1,205 @@
+package datastore
+
+import (
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"rest/model"
+)
+
+// ReceiveLot creates the lot and books its units as a receipt in the same transaction
+func (pd ProductDataStore) ReceiveLot(lot *model.Lot, reference, actor string) error {
+	if lot.Quantity < 1 {
+		return fmt.Errorf("%w: a lot needs a positive quantity", ErrInvalid)
+	}
+	return translate(pd.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&model.Product{}, lot.ProductId).Error; err != nil {
+			return translate(err)
+		}
+		locationId, err := stockLocation(tx, lot.LocationId)
+		if err != nil {
+			return err
+		}
+		lot.LocationId = locationId
+		if lot.ReceivedAt.IsZero() {
+			lot.ReceivedAt = gorm.NowFunc()
+		}
+		if err := openingLots(tx, lot.ProductId); err != nil {
+			return err
+		}
+		if err := tx.Create(lot).Error; err != nil {
+			return translate(err)
+		}
+		receipt := model.StockAdjustment{
+			ProductId: lot.ProductId,
+			OnHand:    lot.Quantity,
+			Reason:    model.ReasonReceipt,
+			Reference: reference,
+			Actor:     actor,
+		}
+		if err := applyAdjustment(tx, receipt, locationId, &lot.Id, &model.Product{}); err != nil {
+			return err
+		}
+		return deriveExpiry(tx, lot.ProductId)
+	}))
+}
+
+// openingLots book the units on hand that no lot holds, such as the stock a product had before its first
+// lot, as a lot of their own at each location. Otherwise nothing could sell, move or write them off, since
+// the stock of a product kept in lots only changes through its lots. The lots take the product's expiry
+func openingLots(tx *gorm.DB, productId int) error {
+	var levels []model.StockLevel
+	err := tx.Set("gorm:query_option", "FOR UPDATE").Where("product_id = ?", productId).Order("location_id").Find(&levels).Error
+	if err != nil {
+		return translate(err)
+	}
+	var lotted []struct{ LocationId, Units int }
+	err = tx.Model(&model.Lot{}).Select("location_id, sum(quantity) AS units").
+		Where("product_id = ?", productId).Group("location_id").Scan(&lotted).Error
+	if err != nil {
+		return translate(err)
+	}
+	inLots := map[int]int{}
+	for _, l := range lotted {
+		inLots[l.LocationId] = l.Units
+	}
+	prod := model.Product{}
+	if err := tx.First(&prod, productId).Error; err != nil {
+		return translate(err)
+	}
+	for _, level := range levels {
+		if level.OnHand <= inLots[level.LocationId] {
+			continue
+		}
+		opening := model.Lot{
+			ProductId:  productId,
+			LotNumber:  fmt.Sprintf("opening-%d", level.LocationId),
+			LocationId: level.LocationId,
+			Quantity:   level.OnHand - inLots[level.LocationId],
+			ReceivedAt: gorm.NowFunc(),
+		}
+		if !prod.Expiry.IsZero() {
+			opening.Expiry = &prod.Expiry
+		}
+		if err := tx.Create(&opening).Error; err != nil { // the units are in the ledger already
+			return translate(err)
+		}
+	}
+	return nil
+}
+
+func (pd ProductDataStore) GetLot(productId, lotId int, lot *model.Lot) error {
+	return translate(pd.db.Where("product_id = ?", productId).First(lot, lotId).Error)
+}
+
+func (pd ProductDataStore) ListLots(productId int) ([]model.Lot, error) {
+	var lots []model.Lot
+	err := pd.db.Where("product_id = ?", productId).Order("expiry NULLS LAST").Order("id").Find(&lots).Error
+	return lots, translate(err)
+}
+
+// AdjustLot takes units from or adds units to a lot with a conditional UPDATE, like AdjustStock does for
+// the stock, and applies the same change to the stock of the product at the location of the lot. A lot
+// the sweep expired cannot be adjusted
+func (pd ProductDataStore) AdjustLot(adj model.LotAdjustment, lot *model.Lot) error {
+	return translate(pd.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("product_id = ?", adj.ProductId).First(lot, adj.LotId).Error; err != nil {
+			return translate(err)
+		}
+		if lot.ExpiredAt != nil {
+			return fmt.Errorf("%w: lot %s was written off as expired", ErrConflict, lot.LotNumber)
+		}
+		update := tx.Exec("UPDATE lots SET quantity = quantity + ? WHERE id = ? AND expired_at IS NULL AND quantity + ? >= 0",
+			adj.Quantity, adj.LotId, adj.Quantity)
+		if update.Error != nil {
+			return translate(update.Error)
+		}
+		if update.RowsAffected == 0 {
+			return fmt.Errorf("%w: %d units left in lot %s", ErrInsufficientStock, lot.Quantity, lot.LotNumber)
+		}
+		stock := model.StockAdjustment{
+			ProductId: adj.ProductId,
+			OnHand:    adj.Quantity,
+			Reason:    adj.Reason,
+			Reference: adj.Reference,
+			Actor:     adj.Actor,
+		}
+		if err := applyAdjustment(tx, stock, lot.LocationId, &lot.Id, &model.Product{}); err != nil {
+			return err
+		}
+		if err := deriveExpiry(tx, adj.ProductId); err != nil {
+			return err
+		}
+		return translate(tx.First(lot, adj.LotId).Error)
+	}))
+}
+
+// withoutLots fails with ErrConflict when the stock of the product is kept in lots, so the levels are not
+// changed behind the back of the lots
+func withoutLots(tx *gorm.DB, productId int) error {
+	var lots int
+	if err := tx.Model(&model.Lot{}).Where("product_id = ?", productId).Count(&lots).Error; err != nil {
+		return translate(err)
+	}
+	if lots > 0 {
+		return fmt.Errorf("%w: product %d is kept in lots, its units change through its lots", ErrConflict, productId)
+	}
+	return nil
+}
+
+// deriveExpiry sets the expiry of the product to the earliest expiry of its lots that still hold units and
+// have not been expired by the sweep. Without such a lot the product keeps the expiry it has
+func deriveExpiry(tx *gorm.DB, productId int) error {
+	err := tx.Exec(`UPDATE products SET expiry = coalesce(
+			(SELECT min(expiry) FROM lots WHERE product_id = products.id AND quantity > 0 AND expired_at IS NULL), expiry)
+		WHERE id = ?`, productId).Error
+	return translate(err)
+}
+
+// AllocateLots locks the lots in id order, so concurrent allocations of a product wait for each other
+// instead of picking the same units
+func (pd ProductDataStore) AllocateLots(a model.Allocation, plan func(lots []model.Lot) ([]model.Pick, error)) ([]model.Pick, error) {
+	var picks []model.Pick
+	err := pd.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&model.Product{}, a.ProductId).Error; err != nil {
+			return translate(err)
+		}
+		var lots []model.Lot
+		db := tx.Set("gorm:query_option", "FOR UPDATE").Where("product_id = ? AND quantity > 0", a.ProductId)
+		if a.LocationId != 0 {
+			db = db.Where("location_id = ?", a.LocationId)
+		}
+		if err := db.Order("id").Find(&lots).Error; err != nil {
+			return translate(err)
+		}
+		var err error
+		if picks, err = plan(lots); err != nil {
+			return err
+		}
+		for _, pick := range picks {
+			lotId := pick.LotId
+			update := tx.Exec("UPDATE lots SET quantity = quantity - ? WHERE id = ? AND product_id = ? AND quantity >= ?",
+				pick.Quantity, pick.LotId, a.ProductId, pick.Quantity)
+			if update.Error != nil {
+				return translate(update.Error)
+			}
+			if update.RowsAffected == 0 {
+				return fmt.Errorf("%w: less than %d units left in lot %s", ErrInsufficientStock, pick.Quantity, pick.LotNumber)
+			}
+			sale := model.StockAdjustment{
+				ProductId: a.ProductId,
+				OnHand:    -pick.Quantity,
+				Reason:    model.ReasonSale,
+				Reference: a.Reference,
+				Actor:     a.Actor,
+			}
+			if err := applyAdjustment(tx, sale, pick.LocationId, &lotId, &model.Product{}); err != nil {
+				return err
+			}
+		}
+		return deriveExpiry(tx, a.ProductId)
+	})
+	if err != nil {
+		return nil, translate(err)
+	}
+	return picks, nil
+}
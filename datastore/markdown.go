@@ -0,0 +1,15 @@
+package datastore
+
+import (
+	"rest/model"
+)
+
+func (pd ProductDataStore) RecordMarkdown(m *model.Markdown) error {
+	return translate(pd.db.Set("gorm:insert_option", "ON CONFLICT DO NOTHING").Create(m).Error)
+}
+
+func (pd ProductDataStore) ListMarkdowns(productId int) ([]model.Markdown, error) {
+	var markdowns []model.Markdown
+	err := pd.db.Where("product_id = ?", productId).Order("starts_at").Order("id").Find(&markdowns).Error
+	return markdowns, translate(err)
+}
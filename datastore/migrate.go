@@ -0,0 +1,83 @@
+package datastore
+
+import (
+	"github.com/jinzhu/gorm"
+	"rest/model"
+)
+
+// statements AutoMigrate cannot express, each one is safe to run again
+var migrations = []string{
+	"CREATE EXTENSION IF NOT EXISTS pg_trgm",
+	"CREATE INDEX IF NOT EXISTS products_name_trgm ON products USING gin (name gin_trgm_ops)",
+	"CREATE INDEX IF NOT EXISTS products_name_fts ON products USING gin (to_tsvector('simple', name))",
+	// categories used to exist only as numbers on products, give each of them a row
+	`INSERT INTO categories (id, name, slug) SELECT DISTINCT category_id, 'Category ' || category_id, 'category-' || category_id
+		FROM products ON CONFLICT DO NOTHING`,
+	"SELECT setval(pg_get_serial_sequence('categories', 'id'), greatest((SELECT max(id) FROM categories), 1))",
+	"UPDATE categories SET slug = 'category-' || id WHERE slug IS NULL OR slug = ''",
+	foreignKey("products_category_id_fkey", "products", "category_id", "categories (id)"),
+	foreignKey("categories_parent_id_fkey", "categories", "parent_id", "categories (id)"),
+	`WITH RECURSIVE tree (id, path) AS (
+		SELECT id, '/' || id || '/' FROM categories WHERE parent_id IS NULL
+		UNION ALL
+		SELECT c.id, tree.path || c.id || '/' FROM categories c JOIN tree ON c.parent_id = tree.id
+	)
+	UPDATE categories SET path = tree.path FROM tree WHERE categories.id = tree.id AND categories.path IS DISTINCT FROM tree.path`,
+	"CREATE INDEX IF NOT EXISTS categories_path ON categories (path text_pattern_ops)",
+	constraint("products_stock_check", "products", "CHECK (on_hand >= 0 AND reserved >= 0 AND reserved <= on_hand)"),
+	// stock counted before the ledger existed becomes its opening balance
+	`INSERT INTO stock_movements (product_id, delta, reserved_delta, reason, reference, created_at)
+		SELECT id, on_hand, reserved, 'adjustment', 'opening balance', now() FROM products p
+		WHERE (on_hand <> 0 OR reserved <> 0) AND NOT EXISTS (SELECT 1 FROM stock_movements m WHERE m.product_id = p.id)`,
+	// the ledger is append only
+	`CREATE OR REPLACE FUNCTION stock_movements_immutable() RETURNS trigger AS $$
+		BEGIN RAISE EXCEPTION 'stock movements cannot be changed'; END
+	$$ LANGUAGE plpgsql`,
+	"DROP TRIGGER IF EXISTS stock_movements_immutable ON stock_movements",
+	`CREATE TRIGGER stock_movements_immutable BEFORE UPDATE OR DELETE ON stock_movements
+		FOR EACH ROW EXECUTE PROCEDURE stock_movements_immutable()`,
+	// stock held before locations existed is held at the main location
+	`INSERT INTO locations (name, code) SELECT 'Main warehouse', 'main'
+		WHERE NOT EXISTS (SELECT 1 FROM locations WHERE code = 'main')`,
+	`INSERT INTO stock_levels (product_id, location_id, on_hand, reserved)
+		SELECT p.id, l.id, p.on_hand, p.reserved FROM products p JOIN locations l ON l.code = 'main'
+		WHERE (p.on_hand <> 0 OR p.reserved <> 0) AND NOT EXISTS (SELECT 1 FROM stock_levels s WHERE s.product_id = p.id)`,
+	foreignKey("stock_levels_product_id_fkey", "stock_levels", "product_id", "products (id) ON DELETE CASCADE"),
+	foreignKey("stock_levels_location_id_fkey", "stock_levels", "location_id", "locations (id)"),
+	constraint("stock_levels_stock_check", "stock_levels", "CHECK (on_hand >= 0 AND reserved >= 0 AND reserved <= on_hand)"),
+	foreignKey("lots_product_id_fkey", "lots", "product_id", "products (id) ON DELETE CASCADE"),
+	foreignKey("lots_location_id_fkey", "lots", "location_id", "locations (id)"),
+	constraint("lots_quantity_check", "lots", "CHECK (quantity >= 0)"),
+	"CREATE INDEX IF NOT EXISTS lots_product_expiry ON lots (product_id, expiry)",
+	"CREATE INDEX IF NOT EXISTS lots_unswept_expiry ON lots (expiry) WHERE expired_at IS NULL",
+	"CREATE INDEX IF NOT EXISTS products_expiry ON products (expiry)",
+	foreignKey("markdowns_product_id_fkey", "markdowns", "product_id", "products (id) ON DELETE CASCADE"),
+}
+
+// foreignKey adds a reference to another table unless it is there already
+func foreignKey(name, table, column, references string) string {
+	return constraint(name, table, "FOREIGN KEY ("+column+") REFERENCES "+references)
+}
+
+// constraint adds a table constraint unless one of that name exists
+func constraint(name, table, definition string) string {
+	return `DO $$ BEGIN
+		IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = '` + name + `') THEN
+			ALTER TABLE ` + table + ` ADD CONSTRAINT ` + name + ` ` + definition + `;
+		END IF;
+	END $$`
+}
+
+// Migrate brings the schema up to date with the models
+func Migrate(db *gorm.DB) error {
+	if err := db.AutoMigrate(&model.Product{}, &model.Category{}, &model.StockMovement{}, &model.Location{}, &model.StockLevel{},
+		&model.Lot{}, &model.Markdown{}).Error; err != nil {
+		return err
+	}
+	for _, statement := range migrations {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package datastore
+
+import (
+	"github.com/jinzhu/gorm"
+	"rest/model"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// PostgresSearcher searches product names with full-text search for whole words and
+// pg_trgm similarity for typos, see Migrate for the indexes behind it
+type PostgresSearcher struct {
+	db *gorm.DB
+}
+
+func NewPostgresSearcher(db *gorm.DB) PostgresSearcher {
+	return PostgresSearcher{
+		db: db,
+	}
+}
+
+const searchSQL = `
+SELECT products.*,
+	greatest(ts_rank(to_tsvector('simple', name), plainto_tsquery('simple', ?)), similarity(name, ?)) AS score,
+	ts_headline('simple', name, plainto_tsquery('simple', ?), 'StartSel=<b>, StopSel=</b>, HighlightAll=true') AS highlight
+FROM products
+WHERE to_tsvector('simple', name) @@ plainto_tsquery('simple', ?) OR name % ?
+ORDER BY score DESC, id
+LIMIT ?`
+
+type searchRow struct {
+	model.Product
+	Score     float64
+	Highlight string
+}
+
+func (ps PostgresSearcher) SearchProducts(query string, limit int) ([]model.SearchHit, error) {
+	var rows []searchRow
+	err := ps.db.Raw(searchSQL, query, query, query, query, query, limit).Scan(&rows).Error
+	if err != nil {
+		return nil, translate(err)
+	}
+	hits := make([]model.SearchHit, len(rows))
+	for i, row := range rows {
+		hits[i] = model.SearchHit{Product: row.Product, Score: row.Score, Highlight: row.Highlight}
+	}
+	return hits, nil
+}
+
+// MemorySearcher is a Searcher over products held in memory, for tests and tools without a database.
+// A word of the query matches a word of the name exactly, as its prefix or within a few typos
+type MemorySearcher struct {
+	mu       sync.RWMutex
+	products map[int]model.Product
+}
+
+func NewMemorySearcher(products ...model.Product) *MemorySearcher {
+	ms := &MemorySearcher{products: map[int]model.Product{}}
+	for _, prod := range products {
+		ms.Add(prod)
+	}
+	return ms
+}
+
+// Add indexes prod, replacing the product with the same id
+func (ms *MemorySearcher) Add(prod model.Product) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.products[prod.Id] = prod
+}
+
+// Remove drops the product with the given id from the index
+func (ms *MemorySearcher) Remove(id int) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	delete(ms.products, id)
+}
+
+func (ms *MemorySearcher) SearchProducts(query string, limit int) ([]model.SearchHit, error) {
+	terms := searchWords(query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	var hits []model.SearchHit
+	for _, prod := range ms.products {
+		if hit, ok := matchName(prod, terms); ok {
+			hits = append(hits, hit)
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].Product.Id < hits[j].Product.Id
+	})
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits, nil
+}
+
+// matchName scores prod against every term of the query, each term has to match some word of the name
+func matchName(prod model.Product, terms []string) (model.SearchHit, bool) {
+	words := strings.FieldsFunc(prod.Name, notWordRune)
+	matched := make([]bool, len(words))
+	total := 0.0
+	for _, term := range terms {
+		best, bestWord := 0.0, -1
+		for i, word := range words {
+			if score := wordScore(term, strings.ToLower(word)); score > best {
+				best, bestWord = score, i
+			}
+		}
+		if bestWord < 0 {
+			return model.SearchHit{}, false
+		}
+		matched[bestWord] = true
+		total += best
+	}
+
+	highlight := prod.Name
+	for i := len(words) - 1; i >= 0; i-- { // back to front so earlier offsets stay valid
+		if matched[i] {
+			highlight = highlightWord(highlight, words, i)
+		}
+	}
+	return model.SearchHit{Product: prod, Score: total / float64(len(terms)), Highlight: highlight}, true
+}
+
+// wordScore is 1 for the same word, a bit less for a prefix and less again for each typo, 0 is no match
+func wordScore(term, word string) float64 {
+	switch {
+	case term == word:
+		return 1
+	case len([]rune(term)) >= 3 && strings.HasPrefix(word, term):
+		return 0.9
+	}
+	distance := editDistance([]rune(term), []rune(word))
+	if distance > allowedTypos(len([]rune(term))) {
+		return 0
+	}
+	return 0.8 - 0.2*float64(distance)
+}
+
+// allowedTypos grows with the length of the word, short words have to be spelled right
+func allowedTypos(length int) int {
+	switch {
+	case length < 4:
+		return 0
+	case length < 8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// editDistance counts the insertions, deletions, substitutions and swaps of neighbouring
+// letters that turn a into b (optimal string alignment)
+func editDistance(a, b []rune) int {
+	rows := make([][]int, len(a)+1)
+	for i := range rows {
+		rows[i] = make([]int, len(b)+1)
+		rows[i][0] = i
+	}
+	for j := range rows[0] {
+		rows[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d := rows[i-1][j-1] + cost
+			if rows[i-1][j]+1 < d {
+				d = rows[i-1][j] + 1
+			}
+			if rows[i][j-1]+1 < d {
+				d = rows[i][j-1] + 1
+			}
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] && rows[i-2][j-2]+1 < d {
+				d = rows[i-2][j-2] + 1
+			}
+			rows[i][j] = d
+		}
+	}
+	return rows[len(a)][len(b)]
+}
+
+// highlightWord wraps the i-th word of name in <b></b>
+func highlightWord(name string, words []string, i int) string {
+	offset := 0
+	for j := 0; j <= i; j++ {
+		at := strings.Index(name[offset:], words[j])
+		if j == i {
+			start := offset + at
+			end := start + len(words[j])
+			return name[:start] + "<b>" + name[start:end] + "</b>" + name[end:]
+		}
+		offset += at + len(words[j])
+	}
+	return name
+}
+
+func searchWords(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), notWordRune)
+}
+
+func notWordRune(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
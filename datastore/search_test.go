@@ -0,0 +1,57 @@
+package datastore
+
+import (
+	"github.com/stretchr/testify/assert"
+	"rest/model"
+	"testing"
+)
+
+func searchNames(hits []model.SearchHit) []string {
+	names := make([]string, len(hits))
+	for i, hit := range hits {
+		names[i] = hit.Product.Name
+	}
+	return names
+}
+
+func TestMemorySearchRanksExactMatchesFirst(t *testing.T) {
+
+	searcher := NewMemorySearcher(
+		model.Product{Id: 1, Name: "Milkshake Powder"},
+		model.Product{Id: 2, Name: "Whole Milk"},
+		model.Product{Id: 3, Name: "Bread"},
+	)
+	hits, err := searcher.SearchProducts("milk", 10)
+
+	assert.Nil(t, err, "no error is expected")
+	assert.Equal(t, []string{"Whole Milk", "Milkshake Powder"}, searchNames(hits), "exact word is expected before prefix")
+	assert.Equal(t, "Whole <b>Milk</b>", hits[0].Highlight, "matching word is expected to be highlighted")
+}
+
+func TestMemorySearchToleratesTypos(t *testing.T) {
+
+	searcher := NewMemorySearcher(model.Product{Id: 1, Name: "Chocolate Biscuits"}, model.Product{Id: 2, Name: "Tea"})
+	hits, _ := searcher.SearchProducts("choclate biscits", 10)
+
+	assert.Equal(t, []string{"Chocolate Biscuits"}, searchNames(hits), "misspelled words are expected to match")
+	assert.Equal(t, "<b>Chocolate</b> <b>Biscuits</b>", hits[0].Highlight, "every matching word is expected to be highlighted")
+	assert.True(t, hits[0].Score < 1, "typos are expected to lower the score")
+
+	hits, _ = searcher.SearchProducts("tee", 10)
+	assert.Empty(t, hits, "short words are expected to need the right spelling")
+}
+
+func TestMemorySearchNeedsEveryWordAndLimits(t *testing.T) {
+
+	searcher := NewMemorySearcher(
+		model.Product{Id: 1, Name: "Green Tea"},
+		model.Product{Id: 2, Name: "Green Apples"},
+		model.Product{Id: 3, Name: "Green Beans"},
+	)
+
+	hits, _ := searcher.SearchProducts("green tea", 10)
+	assert.Equal(t, []string{"Green Tea"}, searchNames(hits), "every word is expected to match")
+
+	hits, _ = searcher.SearchProducts("green", 2)
+	assert.Equal(t, []string{"Green Tea", "Green Apples"}, searchNames(hits), "ties are expected in id order up to the limit")
+}
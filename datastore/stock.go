@@ -0,0 +1,203 @@
+package datastore
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"rest/model"
+)
+
+// the stock conditions every change has to keep, the deltas are bound twice
+const stockGuard = "on_hand + ? >= 0 AND reserved + ? >= 0 AND reserved + ? <= on_hand + ?"
+
+// AdjustStock changes the stock level of the location and the product total with conditional UPDATEs, so
+// concurrent adjustments are serialised by the row locks the database takes and the one that would
+// overdraw the stock matches no row. The ledger entry is written in the same transaction. The units on
+// hand of a product kept in lots only change through its lots, its reservations change here
+func (pd ProductDataStore) AdjustStock(adj model.StockAdjustment, prod *model.Product) error {
+	return translate(pd.db.Transaction(func(tx *gorm.DB) error {
+		locationId, err := stockLocation(tx, adj.LocationId)
+		if err != nil {
+			return err
+		}
+		if adj.OnHand != 0 {
+			if err := withoutLots(tx, adj.ProductId); err != nil {
+				return err
+			}
+		}
+		return applyAdjustment(tx, adj, locationId, nil, prod)
+	}))
+}
+
+// applyAdjustment is AdjustStock within a transaction, for a resolved location and optionally a lot
+func applyAdjustment(tx *gorm.DB, adj model.StockAdjustment, locationId int, lotId *int, prod *model.Product) error {
+	if err := tx.First(prod, adj.ProductId).Error; err != nil {
+		return translate(err)
+	}
+	if err := ensureLevel(tx, adj.ProductId, locationId); err != nil {
+		return err
+	}
+	level := tx.Exec("UPDATE stock_levels SET on_hand = on_hand + ?, reserved = reserved + ? WHERE product_id = ? AND location_id = ? AND "+stockGuard,
+		adj.OnHand, adj.Reserved, adj.ProductId, locationId, adj.OnHand, adj.Reserved, adj.Reserved, adj.OnHand)
+	if level.Error != nil {
+		return translate(level.Error)
+	}
+	if level.RowsAffected == 0 {
+		current := model.StockLevel{}
+		tx.Where("product_id = ? AND location_id = ?", adj.ProductId, locationId).First(&current)
+		return fmt.Errorf("%w: %d on hand and %d reserved at location %d", ErrInsufficientStock, current.OnHand, current.Reserved, locationId)
+	}
+	total := tx.Exec("UPDATE products SET on_hand = on_hand + ?, reserved = reserved + ?, version = version + 1, updated_at = ? WHERE id = ? AND "+stockGuard,
+		adj.OnHand, adj.Reserved, gorm.NowFunc(), adj.ProductId, adj.OnHand, adj.Reserved, adj.Reserved, adj.OnHand)
+	if total.Error != nil {
+		return translate(total.Error)
+	}
+	if total.RowsAffected == 0 {
+		return fmt.Errorf("%w: %d on hand and %d reserved", ErrInsufficientStock, prod.OnHand, prod.Reserved)
+	}
+	if err := tx.First(prod, adj.ProductId).Error; err != nil {
+		return translate(err)
+	}
+	movement := model.StockMovement{
+		ProductId:     adj.ProductId,
+		LocationId:    &locationId,
+		LotId:         lotId,
+		Delta:         adj.OnHand,
+		ReservedDelta: adj.Reserved,
+		Reason:        adj.Reason,
+		Reference:     adj.Reference,
+		Actor:         adj.Actor,
+	}
+	return translate(tx.Create(&movement).Error)
+}
+
+// TransferStock locks both levels in location order, so two transfers in opposite directions cannot
+// deadlock, then moves the units. Only units that are not reserved can leave a location, and products
+// kept in lots cannot be transferred since lots stay where they were received
+func (pd ProductDataStore) TransferStock(t model.StockTransfer, from, to *model.StockLevel) error {
+	if t.FromLocationId == t.ToLocationId || t.Quantity < 1 {
+		return fmt.Errorf("%w: a transfer needs two locations and a positive quantity", ErrInvalid)
+	}
+	return translate(pd.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&model.Product{}, t.ProductId).Error; err != nil {
+			return translate(err)
+		}
+		if err := withoutLots(tx, t.ProductId); err != nil {
+			return err
+		}
+		for _, locationId := range []int{t.FromLocationId, t.ToLocationId} {
+			if err := tx.First(&model.Location{}, locationId).Error; gorm.IsRecordNotFoundError(err) {
+				return fmt.Errorf("%w: location %d does not exist", ErrInvalid, locationId)
+			} else if err != nil {
+				return translate(err)
+			}
+			if err := ensureLevel(tx, t.ProductId, locationId); err != nil {
+				return err
+			}
+		}
+		var locked []model.StockLevel
+		err := tx.Set("gorm:query_option", "FOR UPDATE").
+			Where("product_id = ? AND location_id IN (?)", t.ProductId, []int{t.FromLocationId, t.ToLocationId}).
+			Order("location_id").Find(&locked).Error
+		if err != nil {
+			return translate(err)
+		}
+
+		debit := tx.Exec("UPDATE stock_levels SET on_hand = on_hand - ? WHERE product_id = ? AND location_id = ? AND on_hand - ? >= reserved",
+			t.Quantity, t.ProductId, t.FromLocationId, t.Quantity)
+		if debit.Error != nil {
+			return translate(debit.Error)
+		}
+		if debit.RowsAffected == 0 {
+			return fmt.Errorf("%w: less than %d units available at location %d", ErrInsufficientStock, t.Quantity, t.FromLocationId)
+		}
+		err = tx.Exec("UPDATE stock_levels SET on_hand = on_hand + ? WHERE product_id = ? AND location_id = ?",
+			t.Quantity, t.ProductId, t.ToLocationId).Error
+		if err != nil {
+			return translate(err)
+		}
+
+		transferId := newTransferId()
+		for _, leg := range []struct{ locationId, delta int }{{t.FromLocationId, -t.Quantity}, {t.ToLocationId, t.Quantity}} {
+			locationId := leg.locationId
+			movement := model.StockMovement{
+				ProductId:  t.ProductId,
+				LocationId: &locationId,
+				Delta:      leg.delta,
+				Reason:     model.ReasonTransfer,
+				Reference:  t.Reference,
+				TransferId: transferId,
+				Actor:      t.Actor,
+			}
+			if err := tx.Create(&movement).Error; err != nil {
+				return translate(err)
+			}
+		}
+		if err := tx.Where("product_id = ? AND location_id = ?", t.ProductId, t.FromLocationId).First(from).Error; err != nil {
+			return translate(err)
+		}
+		return translate(tx.Where("product_id = ? AND location_id = ?", t.ProductId, t.ToLocationId).First(to).Error)
+	}))
+}
+
+// stockLocation resolves the location of an adjustment, 0 is the main location
+func stockLocation(tx *gorm.DB, locationId int) (int, error) {
+	location := model.Location{}
+	db := tx.Where("code = ?", model.MainLocation)
+	if locationId != 0 {
+		db = tx.Where("id = ?", locationId)
+	}
+	if err := db.First(&location).Error; gorm.IsRecordNotFoundError(err) {
+		return 0, fmt.Errorf("%w: location %d does not exist", ErrInvalid, locationId)
+	} else if err != nil {
+		return 0, translate(err)
+	}
+	return location.Id, nil
+}
+
+// ensureLevel creates the empty stock level of a product at a location if it has none yet
+func ensureLevel(tx *gorm.DB, productId, locationId int) error {
+	err := tx.Exec("INSERT INTO stock_levels (product_id, location_id, on_hand, reserved) VALUES (?, ?, 0, 0) ON CONFLICT DO NOTHING",
+		productId, locationId).Error
+	return translate(err)
+}
+
+func newTransferId() string {
+	raw := make([]byte, 8)
+	rand.Read(raw)
+	return hex.EncodeToString(raw)
+}
+
+func (pd ProductDataStore) ListMovements(productId int, limit, offset int) ([]model.StockMovement, error) {
+	var movements []model.StockMovement
+	db := pd.db.Where("product_id = ?", productId).Order("id desc").Offset(offset)
+	if limit > 0 {
+		db = db.Limit(limit)
+	}
+	err := db.Find(&movements).Error
+	return movements, translate(err)
+}
+
+// Reconcile recomputes the stock of every product, and of every product at every location, from the
+// ledger and lists the ones that differ
+func (pd ProductDataStore) Reconcile() ([]model.StockDrift, error) {
+	var totals, levels []model.StockDrift
+	err := pd.db.Raw(`SELECT p.id AS product_id, 0 AS location_id, p.on_hand, coalesce(sum(m.delta), 0) AS ledger_on_hand,
+			p.reserved, coalesce(sum(m.reserved_delta), 0) AS ledger_reserved
+		FROM products p LEFT JOIN stock_movements m ON m.product_id = p.id
+		GROUP BY p.id
+		HAVING p.on_hand <> coalesce(sum(m.delta), 0) OR p.reserved <> coalesce(sum(m.reserved_delta), 0)
+		ORDER BY p.id`).Scan(&totals).Error
+	if err != nil {
+		return nil, translate(err)
+	}
+	err = pd.db.Raw(`SELECT s.product_id, s.location_id, s.on_hand, coalesce(sum(m.delta), 0) AS ledger_on_hand,
+			s.reserved, coalesce(sum(m.reserved_delta), 0) AS ledger_reserved
+		FROM stock_levels s LEFT JOIN stock_movements m ON m.product_id = s.product_id
+			AND coalesce(m.location_id, (SELECT id FROM locations WHERE code = ?)) = s.location_id
+		GROUP BY s.product_id, s.location_id
+		HAVING s.on_hand <> coalesce(sum(m.delta), 0) OR s.reserved <> coalesce(sum(m.reserved_delta), 0)
+		ORDER BY s.product_id, s.location_id`, model.MainLocation).Scan(&levels).Error
+	return append(totals, levels...), translate(err)
+}
@@ -0,0 +1,165 @@
+package datastore
+
+import (
+	"rest/model"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// NameIndex is an in-process prefix index of product names, a sorted slice searched by binary search.
+// Every word of a name is a key of its own so "mil" suggests "Whole Milk" too
+type NameIndex struct {
+	mu      sync.RWMutex
+	entries []nameEntry    // ordered by key, then id
+	names   map[int]string // current name of every indexed product
+}
+
+type nameEntry struct {
+	key  string // lower case name from one of its words on
+	id   int
+	name string
+}
+
+// NewNameIndex builds the index from every product in ds
+func NewNameIndex(ds model.Datastore) (*NameIndex, error) {
+	prods, err := ds.GetCategorisedProducts(model.ProductQuery{})
+	if err != nil {
+		return nil, err
+	}
+	index := &NameIndex{}
+	for _, prod := range prods {
+		index.Put(prod)
+	}
+	return index, nil
+}
+
+// Put indexes the current name of prod, replacing its old one
+func (ni *NameIndex) Put(prod model.Product) {
+	ni.mu.Lock()
+	defer ni.mu.Unlock()
+	if name, ok := ni.names[prod.Id]; ok && name == prod.Name {
+		return
+	}
+	ni.remove(prod.Id)
+	if ni.names == nil {
+		ni.names = map[int]string{}
+	}
+	ni.names[prod.Id] = prod.Name
+	for _, key := range nameKeys(prod.Name) {
+		entry := nameEntry{key: key, id: prod.Id, name: prod.Name}
+		i := ni.search(entry)
+		ni.entries = append(ni.entries, nameEntry{})
+		copy(ni.entries[i+1:], ni.entries[i:])
+		ni.entries[i] = entry
+	}
+}
+
+// Remove drops the product with the given id
+func (ni *NameIndex) Remove(id int) {
+	ni.mu.Lock()
+	defer ni.mu.Unlock()
+	ni.remove(id)
+}
+
+func (ni *NameIndex) remove(id int) {
+	name, ok := ni.names[id]
+	if !ok {
+		return
+	}
+	delete(ni.names, id)
+	for _, key := range nameKeys(name) {
+		i := ni.search(nameEntry{key: key, id: id})
+		if i < len(ni.entries) && ni.entries[i].key == key && ni.entries[i].id == id {
+			ni.entries = append(ni.entries[:i], ni.entries[i+1:]...)
+		}
+	}
+}
+
+// search finds where entry is or belongs in the ordered entries
+func (ni *NameIndex) search(entry nameEntry) int {
+	return sort.Search(len(ni.entries), func(i int) bool {
+		e := ni.entries[i]
+		return e.key > entry.key || (e.key == entry.key && e.id >= entry.id)
+	})
+}
+
+// Suggest lists up to limit products whose name, or a word of it, starts with prefix, in name order
+func (ni *NameIndex) Suggest(prefix string, limit int) []model.Suggestion {
+	prefix = strings.ToLower(strings.TrimSpace(prefix))
+	ni.mu.RLock()
+	defer ni.mu.RUnlock()
+
+	suggestions := []model.Suggestion{}
+	seen := map[int]bool{}
+	for i := ni.search(nameEntry{key: prefix}); i < len(ni.entries) && len(suggestions) < limit; i++ {
+		entry := ni.entries[i]
+		if !strings.HasPrefix(entry.key, prefix) {
+			break
+		}
+		if !seen[entry.id] {
+			seen[entry.id] = true
+			suggestions = append(suggestions, model.Suggestion{Id: entry.id, Name: entry.name})
+		}
+	}
+	return suggestions
+}
+
+// nameKeys is the lower case name from the start of each of its words
+func nameKeys(name string) []string {
+	lower := strings.ToLower(name)
+	var keys []string
+	prev := ' '
+	for i, r := range lower {
+		if !notWordRune(r) && notWordRune(prev) {
+			keys = append(keys, lower[i:])
+		}
+		prev = r
+	}
+	return keys
+}
+
+// IndexedDatastore keeps a NameIndex current with every write that goes through the datastore
+type IndexedDatastore struct {
+	model.Datastore
+	index *NameIndex
+}
+
+func NewIndexedDatastore(ds model.Datastore, index *NameIndex) IndexedDatastore {
+	return IndexedDatastore{
+		Datastore: ds,
+		index:     index,
+	}
+}
+
+func (ids IndexedDatastore) Create(prod *model.Product) error {
+	err := ids.Datastore.Create(prod)
+	if err == nil {
+		ids.index.Put(*prod)
+	}
+	return err
+}
+
+func (ids IndexedDatastore) Save(prod *model.Product) error {
+	err := ids.Datastore.Save(prod)
+	if err == nil {
+		ids.index.Put(*prod)
+	}
+	return err
+}
+
+func (ids IndexedDatastore) Update(prod *model.Product, fields map[string]interface{}) error {
+	err := ids.Datastore.Update(prod, fields)
+	if err == nil {
+		ids.index.Put(*prod)
+	}
+	return err
+}
+
+func (ids IndexedDatastore) Delete(prod *model.Product) error {
+	err := ids.Datastore.Delete(prod)
+	if err == nil {
+		ids.index.Remove(prod.Id)
+	}
+	return err
+}
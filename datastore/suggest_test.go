@@ -0,0 +1,34 @@
+package datastore
+
+import (
+	"github.com/stretchr/testify/assert"
+	"rest/model"
+	"testing"
+)
+
+func TestNameIndexSuggestsByNameAndWord(t *testing.T) {
+
+	index := &NameIndex{}
+	index.Put(model.Product{Id: 1, Name: "Whole Milk"})
+	index.Put(model.Product{Id: 2, Name: "Milkshake"})
+	index.Put(model.Product{Id: 3, Name: "Bread"})
+
+	assert.Equal(t, []model.Suggestion{{Id: 1, Name: "Whole Milk"}, {Id: 2, Name: "Milkshake"}}, index.Suggest("MIL", 10), "name and word prefixes are expected")
+	assert.Equal(t, []model.Suggestion{{Id: 1, Name: "Whole Milk"}}, index.Suggest("mil", 1), "the limit is expected to hold")
+	assert.Equal(t, []model.Suggestion{}, index.Suggest("x", 10), "no suggestion is expected")
+}
+
+func TestNameIndexFollowsRenamesAndDeletes(t *testing.T) {
+
+	index := &NameIndex{}
+	index.Put(model.Product{Id: 1, Name: "Whole Milk"})
+	index.Put(model.Product{Id: 1, Name: "Skimmed Milk"})
+	index.Put(model.Product{Id: 2, Name: "Milk Chocolate"})
+
+	assert.Empty(t, index.Suggest("whole", 10), "the old name is expected to be gone")
+	assert.Equal(t, []model.Suggestion{{Id: 1, Name: "Skimmed Milk"}}, index.Suggest("sk", 10), "the new name is expected")
+
+	index.Remove(1)
+	assert.Equal(t, []model.Suggestion{{Id: 2, Name: "Milk Chocolate"}}, index.Suggest("milk", 10), "the deleted product is expected to be gone")
+	assert.Equal(t, 2, len(index.entries), "only the keys of the remaining product are expected")
+}
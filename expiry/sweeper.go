@@ -0,0 +1,78 @@
+// Package expiry takes stock out of sale once it has expired
+package expiry
+
+import (
+	"context"
+	"log"
+	"rest/model"
+	"time"
+)
+
+// Actor is who the ledger names for write-offs of the sweep
+const Actor = "expiry-sweep"
+
+// Sweeper writes off expired stock, one sweep at a time, and publishes an event for every lot or stock
+// level it wrote off
+type Sweeper struct {
+	store   model.ExpiryDatastore
+	now     func() time.Time
+	publish func(model.ExpiryEvent)
+}
+
+type Option func(*Sweeper)
+
+// WithClock replaces the clock that tells what has expired
+func WithClock(now func() time.Time) Option {
+	return func(s *Sweeper) {
+		s.now = now
+	}
+}
+
+// WithPublisher replaces the default of logging every event
+func WithPublisher(publish func(model.ExpiryEvent)) Option {
+	return func(s *Sweeper) {
+		s.publish = publish
+	}
+}
+
+func NewSweeper(store model.ExpiryDatastore, options ...Option) Sweeper {
+	s := Sweeper{store: store, now: time.Now, publish: logEvent}
+	for _, option := range options {
+		option(&s)
+	}
+	return s
+}
+
+// Sweep writes off what has expired by now. The events of what was written off before a failure are
+// published too
+func (s Sweeper) Sweep() ([]model.ExpiryEvent, error) {
+	events, err := s.store.WriteOffExpired(s.now(), Actor)
+	for _, event := range events {
+		s.publish(event)
+	}
+	return events, err
+}
+
+// Run sweeps right away and then every interval until ctx is done
+func (s Sweeper) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := s.Sweep(); err != nil {
+			log.Printf("expiry sweep: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func logEvent(e model.ExpiryEvent) {
+	if e.LotId != 0 {
+		log.Printf("expired: lot %d of product %d at location %d, %d units written off", e.LotId, e.ProductId, e.LocationId, e.Quantity)
+	} else {
+		log.Printf("expired: product %d at location %d, %d units written off", e.ProductId, e.LocationId, e.Quantity)
+	}
+}
@@ -0,0 +1,51 @@
+package expiry
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"rest/model"
+	"testing"
+	"time"
+)
+
+type fakeStore struct {
+	swept  []time.Time
+	events []model.ExpiryEvent
+	err    error
+}
+
+func (f *fakeStore) ExpiringStock(from, until time.Time, categoryId int) ([]model.ExpiringStock, error) {
+	return nil, nil
+}
+
+func (f *fakeStore) WriteOffExpired(now time.Time, actor string) ([]model.ExpiryEvent, error) {
+	f.swept = append(f.swept, now)
+	return f.events, f.err
+}
+
+func TestSweepUsesTheClockAndPublishes(t *testing.T) {
+
+	now := time.Date(2024, 5, 10, 3, 0, 0, 0, time.UTC)
+	store := &fakeStore{events: []model.ExpiryEvent{{ProductId: 3, LotId: 5, LocationId: 1, Quantity: 4, SweptAt: now}}}
+	var published []model.ExpiryEvent
+	sweeper := NewSweeper(store, WithClock(func() time.Time { return now }), WithPublisher(func(e model.ExpiryEvent) {
+		published = append(published, e)
+	}))
+	events, err := sweeper.Sweep()
+
+	assert.Nil(t, err, "no error is expected")
+	assert.Equal(t, []time.Time{now}, store.swept, "a sweep as of the clock is expected")
+	assert.Equal(t, store.events, events, "the events of the sweep are expected")
+	assert.Equal(t, store.events, published, "every event is expected to be published")
+}
+
+func TestSweepPublishesWhatWasWrittenOffBeforeAFailure(t *testing.T) {
+
+	store := &fakeStore{events: []model.ExpiryEvent{{ProductId: 3, Quantity: 4}}, err: errors.New("connection reset")}
+	published := 0
+	sweeper := NewSweeper(store, WithPublisher(func(e model.ExpiryEvent) { published++ }))
+	_, err := sweeper.Sweep()
+
+	assert.NotNil(t, err, "the error is expected")
+	assert.Equal(t, 1, published, "the event of the write-off that happened is expected")
+}
@@ -1,5 +1,5 @@
 // Code generated by MockGen. DO NOT EDIT.
-// Source: rest/model (interfaces: Datastore)
+// Source: rest/model (interfaces: Datastore,CategoryDatastore,StockDatastore,LocationDatastore,LotDatastore,LotAllocator,Allocator,ExpiryDatastore,Pricer,MarkdownDatastore)
 
 // Package mocks is a generated GoMock package.
 package mocks
@@ -7,9 +7,9 @@ package mocks
 import (
 	reflect "reflect"
 	model "rest/model"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
-	gorm "github.com/jinzhu/gorm"
 )
 
 // MockDatastore is a mock of Datastore interface.
@@ -35,6 +35,36 @@ func (m *MockDatastore) EXPECT() *MockDatastoreMockRecorder {
 	return m.recorder
 }
 
+// CategoryExists mocks base method.
+func (m *MockDatastore) CategoryExists(arg0 int) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CategoryExists", arg0)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CategoryExists indicates an expected call of CategoryExists.
+func (mr *MockDatastoreMockRecorder) CategoryExists(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CategoryExists", reflect.TypeOf((*MockDatastore)(nil).CategoryExists), arg0)
+}
+
+// CountProducts mocks base method.
+func (m *MockDatastore) CountProducts(arg0 model.ProductQuery) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountProducts", arg0)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountProducts indicates an expected call of CountProducts.
+func (mr *MockDatastoreMockRecorder) CountProducts(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountProducts", reflect.TypeOf((*MockDatastore)(nil).CountProducts), arg0)
+}
+
 // Create mocks base method.
 func (m *MockDatastore) Create(arg0 *model.Product) error {
 	m.ctrl.T.Helper()
@@ -50,37 +80,26 @@ func (mr *MockDatastoreMockRecorder) Create(arg0 interface{}) *gomock.Call {
 }
 
 // Delete mocks base method.
-func (m *MockDatastore) Delete(arg0 *model.Product, arg1 string) {
-	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "Delete", arg0, arg1)
-}
-
-// Delete indicates an expected call of Delete.
-func (mr *MockDatastoreMockRecorder) Delete(arg0, arg1 interface{}) *gomock.Call {
-	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockDatastore)(nil).Delete), arg0, arg1)
-}
-
-// Find mocks base method.
-func (m *MockDatastore) Find(arg0 *[]model.Product) *gorm.DB {
+func (m *MockDatastore) Delete(arg0 *model.Product) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Find", arg0)
-	ret0, _ := ret[0].(*gorm.DB)
+	ret := m.ctrl.Call(m, "Delete", arg0)
+	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// Find indicates an expected call of Find.
-func (mr *MockDatastoreMockRecorder) Find(arg0 interface{}) *gomock.Call {
+// Delete indicates an expected call of Delete.
+func (mr *MockDatastoreMockRecorder) Delete(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Find", reflect.TypeOf((*MockDatastore)(nil).Find), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockDatastore)(nil).Delete), arg0)
 }
 
 // GetCategorisedProducts mocks base method.
-func (m *MockDatastore) GetCategorisedProducts(arg0 map[string][]string) []model.Product {
+func (m *MockDatastore) GetCategorisedProducts(arg0 model.ProductQuery) ([]model.Product, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "GetCategorisedProducts", arg0)
 	ret0, _ := ret[0].([]model.Product)
-	return ret0
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // GetCategorisedProducts indicates an expected call of GetCategorisedProducts.
@@ -89,32 +108,32 @@ func (mr *MockDatastoreMockRecorder) GetCategorisedProducts(arg0 interface{}) *g
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCategorisedProducts", reflect.TypeOf((*MockDatastore)(nil).GetCategorisedProducts), arg0)
 }
 
-// GetProductForUpdate mocks base method.
-func (m *MockDatastore) GetProductForUpdate(arg0, arg1 string, arg2 *model.Product) error {
+// GetProduct mocks base method.
+func (m *MockDatastore) GetProduct(arg0 int, arg1 *model.Product) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetProductForUpdate", arg0, arg1, arg2)
+	ret := m.ctrl.Call(m, "GetProduct", arg0, arg1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// GetProductForUpdate indicates an expected call of GetProductForUpdate.
-func (mr *MockDatastoreMockRecorder) GetProductForUpdate(arg0, arg1, arg2 interface{}) *gomock.Call {
+// GetProduct indicates an expected call of GetProduct.
+func (mr *MockDatastoreMockRecorder) GetProduct(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProductForUpdate", reflect.TypeOf((*MockDatastore)(nil).GetProductForUpdate), arg0, arg1, arg2)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProduct", reflect.TypeOf((*MockDatastore)(nil).GetProduct), arg0, arg1)
 }
 
-// Order mocks base method.
-func (m *MockDatastore) Order(arg0 string) *gorm.DB {
+// GetProductFields mocks base method.
+func (m *MockDatastore) GetProductFields(arg0 int, arg1 []string, arg2 *model.Product) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Order", arg0)
-	ret0, _ := ret[0].(*gorm.DB)
+	ret := m.ctrl.Call(m, "GetProductFields", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// Order indicates an expected call of Order.
-func (mr *MockDatastoreMockRecorder) Order(arg0 interface{}) *gomock.Call {
+// GetProductFields indicates an expected call of GetProductFields.
+func (mr *MockDatastoreMockRecorder) GetProductFields(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Order", reflect.TypeOf((*MockDatastore)(nil).Order), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProductFields", reflect.TypeOf((*MockDatastore)(nil).GetProductFields), arg0, arg1, arg2)
 }
 
 // Save mocks base method.
@@ -131,16 +150,585 @@ func (mr *MockDatastoreMockRecorder) Save(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Save", reflect.TypeOf((*MockDatastore)(nil).Save), arg0)
 }
 
-// Where mocks base method.
-func (m *MockDatastore) Where(arg0, arg1 string) *gorm.DB {
+// Update mocks base method.
+func (m *MockDatastore) Update(arg0 *model.Product, arg1 map[string]interface{}) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Update", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Update indicates an expected call of Update.
+func (mr *MockDatastoreMockRecorder) Update(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockDatastore)(nil).Update), arg0, arg1)
+}
+
+// MockCategoryDatastore is a mock of CategoryDatastore interface.
+type MockCategoryDatastore struct {
+	ctrl     *gomock.Controller
+	recorder *MockCategoryDatastoreMockRecorder
+}
+
+// MockCategoryDatastoreMockRecorder is the mock recorder for MockCategoryDatastore.
+type MockCategoryDatastoreMockRecorder struct {
+	mock *MockCategoryDatastore
+}
+
+// NewMockCategoryDatastore creates a new mock instance.
+func NewMockCategoryDatastore(ctrl *gomock.Controller) *MockCategoryDatastore {
+	mock := &MockCategoryDatastore{ctrl: ctrl}
+	mock.recorder = &MockCategoryDatastoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockCategoryDatastore) EXPECT() *MockCategoryDatastoreMockRecorder {
+	return m.recorder
+}
+
+// CreateCategory mocks base method.
+func (m *MockCategoryDatastore) CreateCategory(arg0 *model.Category) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateCategory", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateCategory indicates an expected call of CreateCategory.
+func (mr *MockCategoryDatastoreMockRecorder) CreateCategory(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateCategory", reflect.TypeOf((*MockCategoryDatastore)(nil).CreateCategory), arg0)
+}
+
+// DeleteCategory mocks base method.
+func (m *MockCategoryDatastore) DeleteCategory(arg0, arg1 int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteCategory", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteCategory indicates an expected call of DeleteCategory.
+func (mr *MockCategoryDatastoreMockRecorder) DeleteCategory(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteCategory", reflect.TypeOf((*MockCategoryDatastore)(nil).DeleteCategory), arg0, arg1)
+}
+
+// GetCategory mocks base method.
+func (m *MockCategoryDatastore) GetCategory(arg0 int, arg1 *model.Category) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCategory", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// GetCategory indicates an expected call of GetCategory.
+func (mr *MockCategoryDatastoreMockRecorder) GetCategory(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCategory", reflect.TypeOf((*MockCategoryDatastore)(nil).GetCategory), arg0, arg1)
+}
+
+// ListCategories mocks base method.
+func (m *MockCategoryDatastore) ListCategories() ([]model.Category, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListCategories")
+	ret0, _ := ret[0].([]model.Category)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListCategories indicates an expected call of ListCategories.
+func (mr *MockCategoryDatastoreMockRecorder) ListCategories() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListCategories", reflect.TypeOf((*MockCategoryDatastore)(nil).ListCategories))
+}
+
+// SaveCategory mocks base method.
+func (m *MockCategoryDatastore) SaveCategory(arg0 *model.Category) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveCategory", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveCategory indicates an expected call of SaveCategory.
+func (mr *MockCategoryDatastoreMockRecorder) SaveCategory(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveCategory", reflect.TypeOf((*MockCategoryDatastore)(nil).SaveCategory), arg0)
+}
+
+// MockStockDatastore is a mock of StockDatastore interface.
+type MockStockDatastore struct {
+	ctrl     *gomock.Controller
+	recorder *MockStockDatastoreMockRecorder
+}
+
+// MockStockDatastoreMockRecorder is the mock recorder for MockStockDatastore.
+type MockStockDatastoreMockRecorder struct {
+	mock *MockStockDatastore
+}
+
+// NewMockStockDatastore creates a new mock instance.
+func NewMockStockDatastore(ctrl *gomock.Controller) *MockStockDatastore {
+	mock := &MockStockDatastore{ctrl: ctrl}
+	mock.recorder = &MockStockDatastoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockStockDatastore) EXPECT() *MockStockDatastoreMockRecorder {
+	return m.recorder
+}
+
+// AdjustStock mocks base method.
+func (m *MockStockDatastore) AdjustStock(arg0 model.StockAdjustment, arg1 *model.Product) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Where", arg0, arg1)
-	ret0, _ := ret[0].(*gorm.DB)
+	ret := m.ctrl.Call(m, "AdjustStock", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AdjustStock indicates an expected call of AdjustStock.
+func (mr *MockStockDatastoreMockRecorder) AdjustStock(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AdjustStock", reflect.TypeOf((*MockStockDatastore)(nil).AdjustStock), arg0, arg1)
+}
+
+// ListMovements mocks base method.
+func (m *MockStockDatastore) ListMovements(arg0, arg1, arg2 int) ([]model.StockMovement, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListMovements", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]model.StockMovement)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListMovements indicates an expected call of ListMovements.
+func (mr *MockStockDatastoreMockRecorder) ListMovements(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListMovements", reflect.TypeOf((*MockStockDatastore)(nil).ListMovements), arg0, arg1, arg2)
+}
+
+// Reconcile mocks base method.
+func (m *MockStockDatastore) Reconcile() ([]model.StockDrift, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Reconcile")
+	ret0, _ := ret[0].([]model.StockDrift)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Reconcile indicates an expected call of Reconcile.
+func (mr *MockStockDatastoreMockRecorder) Reconcile() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reconcile", reflect.TypeOf((*MockStockDatastore)(nil).Reconcile))
+}
+
+// TransferStock mocks base method.
+func (m *MockStockDatastore) TransferStock(arg0 model.StockTransfer, arg1, arg2 *model.StockLevel) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TransferStock", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// TransferStock indicates an expected call of TransferStock.
+func (mr *MockStockDatastoreMockRecorder) TransferStock(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TransferStock", reflect.TypeOf((*MockStockDatastore)(nil).TransferStock), arg0, arg1, arg2)
+}
+
+// MockLocationDatastore is a mock of LocationDatastore interface.
+type MockLocationDatastore struct {
+	ctrl     *gomock.Controller
+	recorder *MockLocationDatastoreMockRecorder
+}
+
+// MockLocationDatastoreMockRecorder is the mock recorder for MockLocationDatastore.
+type MockLocationDatastoreMockRecorder struct {
+	mock *MockLocationDatastore
+}
+
+// NewMockLocationDatastore creates a new mock instance.
+func NewMockLocationDatastore(ctrl *gomock.Controller) *MockLocationDatastore {
+	mock := &MockLocationDatastore{ctrl: ctrl}
+	mock.recorder = &MockLocationDatastoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockLocationDatastore) EXPECT() *MockLocationDatastoreMockRecorder {
+	return m.recorder
+}
+
+// CreateLocation mocks base method.
+func (m *MockLocationDatastore) CreateLocation(arg0 *model.Location) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateLocation", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateLocation indicates an expected call of CreateLocation.
+func (mr *MockLocationDatastoreMockRecorder) CreateLocation(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateLocation", reflect.TypeOf((*MockLocationDatastore)(nil).CreateLocation), arg0)
+}
+
+// GetLocation mocks base method.
+func (m *MockLocationDatastore) GetLocation(arg0 int, arg1 *model.Location) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLocation", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// GetLocation indicates an expected call of GetLocation.
+func (mr *MockLocationDatastoreMockRecorder) GetLocation(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLocation", reflect.TypeOf((*MockLocationDatastore)(nil).GetLocation), arg0, arg1)
+}
+
+// ListLocationStock mocks base method.
+func (m *MockLocationDatastore) ListLocationStock(arg0, arg1, arg2 int) ([]model.LocationStock, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListLocationStock", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]model.LocationStock)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListLocationStock indicates an expected call of ListLocationStock.
+func (mr *MockLocationDatastoreMockRecorder) ListLocationStock(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListLocationStock", reflect.TypeOf((*MockLocationDatastore)(nil).ListLocationStock), arg0, arg1, arg2)
+}
+
+// ListLocations mocks base method.
+func (m *MockLocationDatastore) ListLocations() ([]model.Location, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListLocations")
+	ret0, _ := ret[0].([]model.Location)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListLocations indicates an expected call of ListLocations.
+func (mr *MockLocationDatastoreMockRecorder) ListLocations() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListLocations", reflect.TypeOf((*MockLocationDatastore)(nil).ListLocations))
+}
+
+// MockLotDatastore is a mock of LotDatastore interface.
+type MockLotDatastore struct {
+	ctrl     *gomock.Controller
+	recorder *MockLotDatastoreMockRecorder
+}
+
+// MockLotDatastoreMockRecorder is the mock recorder for MockLotDatastore.
+type MockLotDatastoreMockRecorder struct {
+	mock *MockLotDatastore
+}
+
+// NewMockLotDatastore creates a new mock instance.
+func NewMockLotDatastore(ctrl *gomock.Controller) *MockLotDatastore {
+	mock := &MockLotDatastore{ctrl: ctrl}
+	mock.recorder = &MockLotDatastoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockLotDatastore) EXPECT() *MockLotDatastoreMockRecorder {
+	return m.recorder
+}
+
+// AdjustLot mocks base method.
+func (m *MockLotDatastore) AdjustLot(arg0 model.LotAdjustment, arg1 *model.Lot) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AdjustLot", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AdjustLot indicates an expected call of AdjustLot.
+func (mr *MockLotDatastoreMockRecorder) AdjustLot(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AdjustLot", reflect.TypeOf((*MockLotDatastore)(nil).AdjustLot), arg0, arg1)
+}
+
+// GetLot mocks base method.
+func (m *MockLotDatastore) GetLot(arg0, arg1 int, arg2 *model.Lot) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLot", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// GetLot indicates an expected call of GetLot.
+func (mr *MockLotDatastoreMockRecorder) GetLot(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLot", reflect.TypeOf((*MockLotDatastore)(nil).GetLot), arg0, arg1, arg2)
+}
+
+// ListLots mocks base method.
+func (m *MockLotDatastore) ListLots(arg0 int) ([]model.Lot, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListLots", arg0)
+	ret0, _ := ret[0].([]model.Lot)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListLots indicates an expected call of ListLots.
+func (mr *MockLotDatastoreMockRecorder) ListLots(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListLots", reflect.TypeOf((*MockLotDatastore)(nil).ListLots), arg0)
+}
+
+// ReceiveLot mocks base method.
+func (m *MockLotDatastore) ReceiveLot(arg0 *model.Lot, arg1, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReceiveLot", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReceiveLot indicates an expected call of ReceiveLot.
+func (mr *MockLotDatastoreMockRecorder) ReceiveLot(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReceiveLot", reflect.TypeOf((*MockLotDatastore)(nil).ReceiveLot), arg0, arg1, arg2)
+}
+
+// MockLotAllocator is a mock of LotAllocator interface.
+type MockLotAllocator struct {
+	ctrl     *gomock.Controller
+	recorder *MockLotAllocatorMockRecorder
+}
+
+// MockLotAllocatorMockRecorder is the mock recorder for MockLotAllocator.
+type MockLotAllocatorMockRecorder struct {
+	mock *MockLotAllocator
+}
+
+// NewMockLotAllocator creates a new mock instance.
+func NewMockLotAllocator(ctrl *gomock.Controller) *MockLotAllocator {
+	mock := &MockLotAllocator{ctrl: ctrl}
+	mock.recorder = &MockLotAllocatorMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockLotAllocator) EXPECT() *MockLotAllocatorMockRecorder {
+	return m.recorder
+}
+
+// AllocateLots mocks base method.
+func (m *MockLotAllocator) AllocateLots(arg0 model.Allocation, arg1 func([]model.Lot) ([]model.Pick, error)) ([]model.Pick, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AllocateLots", arg0, arg1)
+	ret0, _ := ret[0].([]model.Pick)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AllocateLots indicates an expected call of AllocateLots.
+func (mr *MockLotAllocatorMockRecorder) AllocateLots(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AllocateLots", reflect.TypeOf((*MockLotAllocator)(nil).AllocateLots), arg0, arg1)
+}
+
+// MockAllocator is a mock of Allocator interface.
+type MockAllocator struct {
+	ctrl     *gomock.Controller
+	recorder *MockAllocatorMockRecorder
+}
+
+// MockAllocatorMockRecorder is the mock recorder for MockAllocator.
+type MockAllocatorMockRecorder struct {
+	mock *MockAllocator
+}
+
+// NewMockAllocator creates a new mock instance.
+func NewMockAllocator(ctrl *gomock.Controller) *MockAllocator {
+	mock := &MockAllocator{ctrl: ctrl}
+	mock.recorder = &MockAllocatorMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockAllocator) EXPECT() *MockAllocatorMockRecorder {
+	return m.recorder
+}
+
+// Allocate mocks base method.
+func (m *MockAllocator) Allocate(arg0 model.Allocation) ([]model.Pick, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Allocate", arg0)
+	ret0, _ := ret[0].([]model.Pick)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Allocate indicates an expected call of Allocate.
+func (mr *MockAllocatorMockRecorder) Allocate(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Allocate", reflect.TypeOf((*MockAllocator)(nil).Allocate), arg0)
+}
+
+// MockExpiryDatastore is a mock of ExpiryDatastore interface.
+type MockExpiryDatastore struct {
+	ctrl     *gomock.Controller
+	recorder *MockExpiryDatastoreMockRecorder
+}
+
+// MockExpiryDatastoreMockRecorder is the mock recorder for MockExpiryDatastore.
+type MockExpiryDatastoreMockRecorder struct {
+	mock *MockExpiryDatastore
+}
+
+// NewMockExpiryDatastore creates a new mock instance.
+func NewMockExpiryDatastore(ctrl *gomock.Controller) *MockExpiryDatastore {
+	mock := &MockExpiryDatastore{ctrl: ctrl}
+	mock.recorder = &MockExpiryDatastoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockExpiryDatastore) EXPECT() *MockExpiryDatastoreMockRecorder {
+	return m.recorder
+}
+
+// ExpiringStock mocks base method.
+func (m *MockExpiryDatastore) ExpiringStock(arg0, arg1 time.Time, arg2 int) ([]model.ExpiringStock, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExpiringStock", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]model.ExpiringStock)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExpiringStock indicates an expected call of ExpiringStock.
+func (mr *MockExpiryDatastoreMockRecorder) ExpiringStock(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExpiringStock", reflect.TypeOf((*MockExpiryDatastore)(nil).ExpiringStock), arg0, arg1, arg2)
+}
+
+// WriteOffExpired mocks base method.
+func (m *MockExpiryDatastore) WriteOffExpired(arg0 time.Time, arg1 string) ([]model.ExpiryEvent, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WriteOffExpired", arg0, arg1)
+	ret0, _ := ret[0].([]model.ExpiryEvent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// WriteOffExpired indicates an expected call of WriteOffExpired.
+func (mr *MockExpiryDatastoreMockRecorder) WriteOffExpired(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteOffExpired", reflect.TypeOf((*MockExpiryDatastore)(nil).WriteOffExpired), arg0, arg1)
+}
+
+// MockPricer is a mock of Pricer interface.
+type MockPricer struct {
+	ctrl     *gomock.Controller
+	recorder *MockPricerMockRecorder
+}
+
+// MockPricerMockRecorder is the mock recorder for MockPricer.
+type MockPricerMockRecorder struct {
+	mock *MockPricer
+}
+
+// NewMockPricer creates a new mock instance.
+func NewMockPricer(ctrl *gomock.Controller) *MockPricer {
+	mock := &MockPricer{ctrl: ctrl}
+	mock.recorder = &MockPricerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockPricer) EXPECT() *MockPricerMockRecorder {
+	return m.recorder
+}
+
+// Markdown mocks base method.
+func (m *MockPricer) Markdown(arg0 model.Product) (model.Markdown, bool) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Markdown", arg0)
+	ret0, _ := ret[0].(model.Markdown)
+	ret1, _ := ret[1].(bool)
+	return ret0, ret1
+}
+
+// Markdown indicates an expected call of Markdown.
+func (mr *MockPricerMockRecorder) Markdown(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Markdown", reflect.TypeOf((*MockPricer)(nil).Markdown), arg0)
+}
+
+// Schedule mocks base method.
+func (m *MockPricer) Schedule(arg0 model.Product) []model.Markdown {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Schedule", arg0)
+	ret0, _ := ret[0].([]model.Markdown)
+	return ret0
+}
+
+// Schedule indicates an expected call of Schedule.
+func (mr *MockPricerMockRecorder) Schedule(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Schedule", reflect.TypeOf((*MockPricer)(nil).Schedule), arg0)
+}
+
+// MockMarkdownDatastore is a mock of MarkdownDatastore interface.
+type MockMarkdownDatastore struct {
+	ctrl     *gomock.Controller
+	recorder *MockMarkdownDatastoreMockRecorder
+}
+
+// MockMarkdownDatastoreMockRecorder is the mock recorder for MockMarkdownDatastore.
+type MockMarkdownDatastoreMockRecorder struct {
+	mock *MockMarkdownDatastore
+}
+
+// NewMockMarkdownDatastore creates a new mock instance.
+func NewMockMarkdownDatastore(ctrl *gomock.Controller) *MockMarkdownDatastore {
+	mock := &MockMarkdownDatastore{ctrl: ctrl}
+	mock.recorder = &MockMarkdownDatastoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockMarkdownDatastore) EXPECT() *MockMarkdownDatastoreMockRecorder {
+	return m.recorder
+}
+
+// ListMarkdowns mocks base method.
+func (m *MockMarkdownDatastore) ListMarkdowns(arg0 int) ([]model.Markdown, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListMarkdowns", arg0)
+	ret0, _ := ret[0].([]model.Markdown)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListMarkdowns indicates an expected call of ListMarkdowns.
+func (mr *MockMarkdownDatastoreMockRecorder) ListMarkdowns(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListMarkdowns", reflect.TypeOf((*MockMarkdownDatastore)(nil).ListMarkdowns), arg0)
+}
+
+// RecordMarkdown mocks base method.
+func (m *MockMarkdownDatastore) RecordMarkdown(arg0 *model.Markdown) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RecordMarkdown", arg0)
+	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// Where indicates an expected call of Where.
-func (mr *MockDatastoreMockRecorder) Where(arg0, arg1 interface{}) *gomock.Call {
+// RecordMarkdown indicates an expected call of RecordMarkdown.
+func (mr *MockMarkdownDatastoreMockRecorder) RecordMarkdown(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Where", reflect.TypeOf((*MockDatastore)(nil).Where), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecordMarkdown", reflect.TypeOf((*MockMarkdownDatastore)(nil).RecordMarkdown), arg0)
 }
@@ -6,17 +6,272 @@ import (
 
 
 type Product struct{
-	Id int `gorm:"primaryKey"; json : id`
-	Name string  `gorm:"unique; not null"; json : name`
-	Price float32 `gorm:"not null";json : price`
-	Expiry time.Time `gorm:"not null"; json : expiry`
-	CategoryId int `gorm:"not null"; json : categoryId`
+	Id int `gorm:"primary_key"`
+	Name string  `gorm:"unique;not null"`
+	Price float32 `gorm:"not null"`
+	Expiry time.Time `gorm:"not null"`
+	CategoryId int `gorm:"not null"`
+	Version int `gorm:"not null;default:1"` // bumped by every write, used for optimistic locking
+	OnHand int `gorm:"not null;default:0"` // units over all locations, only changed through AdjustStock
+	Reserved int `gorm:"not null;default:0"` // units of OnHand promised to orders
+	UpdatedAt time.Time
+}
+
+// Available is what can still be promised to an order
+func (p Product) Available() int {
+	return p.OnHand - p.Reserved
+}
+
+// Category groups products, every product belongs to one. Categories nest through ParentId
+type Category struct {
+	Id          int    `gorm:"primary_key"`
+	Name        string `gorm:"unique;not null"`
+	Slug        string `gorm:"unique"` // url friendly name, e.g. "dairy-products"
+	ParentId    *int   // nil for a top level category
+	Description string
+	Path        string // ids from the root down to the category itself, e.g. "/1/5/12/", kept by the datastore
 }
 
 type Datastore interface {
 	Create(model *Product) (err error)
-	Delete(model *Product, id string)
+	Delete(model *Product) (err error)
 	Save(model *Product) (err error)
-	GetCategorisedProducts(params map[string][]string) []Product
-	GetProductForUpdate(query string,id string,pd *Product)(err error)
-}
\ No newline at end of file
+	Update(model *Product, fields map[string]interface{}) (err error) // fields are keyed by Product field name
+	GetCategorisedProducts(q ProductQuery) ([]Product, error)
+	CountProducts(q ProductQuery) (int, error)
+	GetProduct(id int, pd *Product) (err error)
+	GetProductFields(id int, fields []string, pd *Product) error // loads only what the fields are built from
+	CategoryExists(id int) (bool, error)
+}
+
+type CategoryDatastore interface {
+	CreateCategory(c *Category) error
+	GetCategory(id int, c *Category) error
+	ListCategories() ([]Category, error)
+	SaveCategory(c *Category) error
+	DeleteCategory(id int, reassignTo int) error // reassignTo moves the products of the category first, 0 refuses while it has any
+}
+
+// reasons stock moves for
+const (
+	ReasonReceipt     = "receipt"
+	ReasonSale        = "sale"
+	ReasonReturn      = "return"
+	ReasonAdjustment  = "adjustment" // stock count corrections
+	ReasonTransfer    = "transfer"
+	ReasonWriteOff    = "write-off" // damaged, lost or expired units
+	ReasonReservation = "reservation"
+	ReasonRelease     = "release"
+)
+
+// Location is a store or warehouse that holds stock
+type Location struct {
+	Id   int    `gorm:"primary_key"`
+	Name string `gorm:"unique;not null"`
+	Code string `gorm:"unique;not null"` // short name, e.g. "main" for the location stock defaults to
+}
+
+// MainLocation is the code of the location that holds stock adjusted without a location
+const MainLocation = "main"
+
+// StockLevel is the stock of one product at one location, the levels of a product add up to its stock
+type StockLevel struct {
+	ProductId  int `gorm:"primary_key;auto_increment:false"`
+	LocationId int `gorm:"primary_key;auto_increment:false"`
+	OnHand     int `gorm:"not null;default:0"`
+	Reserved   int `gorm:"not null;default:0"`
+}
+
+func (l StockLevel) Available() int {
+	return l.OnHand - l.Reserved
+}
+
+// LocationStock is a product as stocked at one location
+type LocationStock struct {
+	Product Product
+	Level   StockLevel
+}
+
+type LocationDatastore interface {
+	CreateLocation(l *Location) error
+	GetLocation(id int, l *Location) error
+	ListLocations() ([]Location, error)
+	ListLocationStock(locationId int, limit, offset int) ([]LocationStock, error) // ordered by product name
+}
+
+// StockAdjustment changes the stock of one product at one location by the given amounts
+type StockAdjustment struct {
+	ProductId  int
+	LocationId int // 0 is the main location
+	OnHand     int // added to the units on hand, negative takes units away
+	Reserved   int // added to the reserved units
+	Reason     string
+	Reference  string // e.g. the order or delivery note the change belongs to
+	Actor      string // who made the change
+}
+
+// StockTransfer moves units of a product from one location to another
+type StockTransfer struct {
+	ProductId      int
+	FromLocationId int
+	ToLocationId   int
+	Quantity       int
+	Reference      string
+	Actor          string
+}
+
+// Lot is one received batch of a product, held at one location. The earliest expiry of the lots that
+// still hold units is the expiry of the product
+type Lot struct {
+	Id         int        `gorm:"primary_key"`
+	ProductId  int        `gorm:"not null;unique_index:lots_product_lot_number"`
+	LotNumber  string     `gorm:"not null;unique_index:lots_product_lot_number"` // as printed by the supplier
+	LocationId int        `gorm:"not null"`
+	Quantity   int        `gorm:"not null;default:0"` // units left, part of the stock of the product at the location
+	Expiry     *time.Time // nil when the lot does not expire
+	ReceivedAt time.Time  `gorm:"not null"`
+	ExpiredAt  *time.Time // set when the expiry sweep wrote the lot off, it is not sold from any more
+}
+
+// LotAdjustment changes the units left in a lot, and the stock of its product with them
+type LotAdjustment struct {
+	ProductId int
+	LotId     int
+	Quantity  int // added to the units of the lot, negative takes units away
+	Reason    string
+	Reference string
+	Actor     string
+}
+
+type LotDatastore interface {
+	// ReceiveLot stores a new lot and books its units as a receipt at its location, 0 being the main location
+	ReceiveLot(lot *Lot, reference, actor string) error
+	GetLot(productId, lotId int, lot *Lot) error
+	ListLots(productId int) ([]Lot, error) // earliest expiry first, lots that do not expire last
+	// AdjustLot applies the adjustment to the lot and the stock in one transaction and loads the lot as it is
+	// afterwards. A lot cannot drop below zero units
+	AdjustLot(adj LotAdjustment, lot *Lot) error
+}
+
+// Allocation asks for units of a product to be picked from its lots
+type Allocation struct {
+	ProductId  int
+	LocationId int // 0 picks from every location
+	Quantity   int
+	Reference  string // e.g. the order the units are picked for
+	Actor      string
+}
+
+// Pick is the part of an allocation taken from one lot
+type Pick struct {
+	LotId      int
+	LotNumber  string
+	LocationId int
+	Quantity   int
+	Expiry     *time.Time
+}
+
+// LotAllocator takes allocated units out of lots
+type LotAllocator interface {
+	// AllocateLots locks the lots of the product that hold units, at the location of the allocation or at
+	// every location, and passes them to plan. The picks plan returns are taken from the lots and sold from
+	// the stock in the same transaction
+	AllocateLots(a Allocation, plan func(lots []Lot) ([]Pick, error)) ([]Pick, error)
+}
+
+type Allocator interface {
+	Allocate(a Allocation) ([]Pick, error)
+}
+
+// ExpiringStock is stock that expires within a report's window, LotId is 0 for stock of a product without lots
+type ExpiringStock struct {
+	ProductId   int
+	ProductName string
+	CategoryId  int
+	LotId       int
+	LotNumber   string
+	LocationId  int
+	Quantity    int
+	Expiry      time.Time
+}
+
+// ExpiryEvent tells that expired stock was written off, LotId is 0 for stock of a product without lots
+type ExpiryEvent struct {
+	ProductId  int
+	LotId      int
+	LocationId int
+	Quantity   int // units written off
+	Expiry     time.Time
+	SweptAt    time.Time
+}
+
+type ExpiryDatastore interface {
+	// ExpiringStock lists the stock that expires after from and until until, soonest first. A categoryId
+	// other than 0 restricts it to that category and its subcategories
+	ExpiringStock(from, until time.Time, categoryId int) ([]ExpiringStock, error)
+	// WriteOffExpired marks the lots that expired by now and writes off their units, and the stock of
+	// products without lots that expired by now, each with a write-off ledger entry
+	WriteOffExpired(now time.Time, actor string) ([]ExpiryEvent, error)
+}
+
+// Markdown is a discount on a product as its expiry approaches. Stored ones are the history of the
+// markdowns that took effect
+type Markdown struct {
+	Id        int       `gorm:"primary_key"`
+	ProductId int       `gorm:"not null;unique_index:markdowns_step"`
+	Percent   float64   `gorm:"not null;unique_index:markdowns_step"` // off the list price
+	ListPrice float32   `gorm:"not null;unique_index:markdowns_step"`
+	Price     float32   `gorm:"not null"` // the list price with the markdown taken off
+	StartsAt  time.Time `gorm:"not null;unique_index:markdowns_step"`
+	CreatedAt time.Time
+}
+
+type Pricer interface {
+	// Markdown is the markdown in effect for the product now, if any
+	Markdown(p Product) (Markdown, bool)
+	// Schedule is every markdown step of the product, earliest first
+	Schedule(p Product) []Markdown
+}
+
+type MarkdownDatastore interface {
+	RecordMarkdown(m *Markdown) error // a markdown that is already recorded is left as it is
+	ListMarkdowns(productId int) ([]Markdown, error) // oldest first
+}
+
+// StockMovement is one entry of the stock ledger, it is written with every adjustment and never changed.
+// The deltas of a product add up to its current stock. A transfer is a pair of entries sharing a TransferId
+type StockMovement struct {
+	Id            int    `gorm:"primary_key"`
+	ProductId     int    `gorm:"not null;index"`
+	LocationId    *int   // nil on entries written before locations existed, they belong to the main location
+	LotId         *int   // the lot the units came from or went to, if any
+	Delta         int    `gorm:"not null"` // change of the units on hand
+	ReservedDelta int    `gorm:"not null;default:0"`
+	Reason        string `gorm:"not null"`
+	Reference     string
+	TransferId    string
+	Actor         string
+	CreatedAt     time.Time
+}
+
+// StockDrift is stock that differs from the sum of its ledger, LocationId is 0 for the total of a product
+type StockDrift struct {
+	ProductId      int
+	LocationId     int
+	OnHand         int
+	LedgerOnHand   int
+	Reserved       int
+	LedgerReserved int
+}
+
+type StockDatastore interface {
+	// AdjustStock applies the adjustment atomically, records it in the ledger in the same transaction and
+	// loads the product as it is afterwards into prod. It never lets on hand or reserved drop below zero,
+	// nor reserved exceed on hand, at the location or in total
+	AdjustStock(adj StockAdjustment, prod *Product) error
+	// TransferStock debits one location and credits the other in one transaction, recorded as two
+	// ledger entries. It loads the levels as they are afterwards into from and to
+	TransferStock(t StockTransfer, from, to *StockLevel) error
+	ListMovements(productId int, limit, offset int) ([]StockMovement, error) // newest first
+	Reconcile() ([]StockDrift, error)
+}
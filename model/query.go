@@ -0,0 +1,51 @@
+package model
+
+// ProductQuery is a product listing request as the datastore sees it, already validated by the api
+type ProductQuery struct {
+	Filters []Filter  // every filter must hold
+	Sort    []SortKey // the datastore always breaks ties on id
+	Fields  []string  // api field names to load, empty loads them all; the order keys are always loaded
+	Limit   int       // 0 means no limit
+	Offset  int
+	After   []string // keyset cursor: values of the OrderKeys of the row to continue after
+	Before  []string // keyset cursor: values of the OrderKeys of the row to stop before
+}
+
+// OrderKeys is the full order of a listing: the sort keys followed by id, unless id is sorted on already
+func (q ProductQuery) OrderKeys() []SortKey {
+	keys := append([]SortKey{}, q.Sort...)
+	for _, key := range keys {
+		if key.Field == "id" {
+			return keys
+		}
+	}
+	return append(keys, SortKey{Field: "id"})
+}
+
+// SortKey orders a listing by one product field
+type SortKey struct {
+	Field string // api field name, e.g. "price" or "categoryId"
+	Desc  bool
+}
+
+// Filter is one condition on a product field
+type Filter struct {
+	Field  string        // api field name, e.g. "price" or "categoryId"
+	Op     string        // one of the Op constants
+	Values []interface{} // int, float64, string or time.Time depending on the field; only OpIn takes several
+}
+
+// operators a Filter can apply
+const (
+	OpEq     = "eq"
+	OpNe     = "ne"
+	OpGt     = "gt"
+	OpGte    = "gte"
+	OpLt     = "lt"
+	OpLte    = "lte"
+	OpIn     = "in"
+	OpPrefix = "prefix"
+	OpBefore = "before"
+	OpAfter  = "after"
+	OpUnder  = "under" // categoryId is one of the given categories or below them in the tree
+)
@@ -0,0 +1,24 @@
+package model
+
+// SearchHit is one product found by a name search
+type SearchHit struct {
+	Product   Product
+	Score     float64 // relevance between 0 and 1, higher is better
+	Highlight string  // the name with the matching words wrapped in <b></b>
+}
+
+// Searcher finds products by name, tolerating typos. Hits come best first
+type Searcher interface {
+	SearchProducts(query string, limit int) ([]SearchHit, error)
+}
+
+// Suggestion is a product name offered while the user is typing
+type Suggestion struct {
+	Id   int
+	Name string
+}
+
+// Suggester completes product names from a prefix of the name or of one of its words
+type Suggester interface {
+	Suggest(prefix string, limit int) []Suggestion
+}
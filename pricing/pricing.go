@@ -0,0 +1,128 @@
+// Package pricing marks perishable products down as their expiry approaches
+package pricing
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"rest/model"
+	"sort"
+	"time"
+)
+
+// Rule takes Percent off the list price from Days before the expiry on. A rule with a CategoryId applies
+// to that category only, the others to every category that has no rules of its own
+type Rule struct {
+	CategoryId int     `json:"categoryId,omitempty"`
+	Days       float64 `json:"days"`
+	Percent    float64 `json:"percent"`
+}
+
+func (r Rule) before() time.Duration {
+	return time.Duration(r.Days * float64(24*time.Hour))
+}
+
+// ParseRules reads rules such as [{"days": 3, "percent": 20}, {"categoryId": 4, "days": 1, "percent": 50}]
+func ParseRules(r io.Reader) ([]Rule, error) {
+	var rules []Rule
+	if err := json.NewDecoder(r).Decode(&rules); err != nil {
+		return nil, fmt.Errorf("markdown rules are not valid JSON: %w", err)
+	}
+	for i, rule := range rules {
+		if rule.Days <= 0 || rule.Percent <= 0 || rule.Percent >= 100 {
+			return nil, fmt.Errorf("markdown rule %d needs days above 0 and a percent between 0 and 100", i)
+		}
+	}
+	return rules, nil
+}
+
+// Engine computes markdowns from the price, expiry and category of a product
+type Engine struct {
+	rules []Rule
+	now   func() time.Time
+}
+
+type Option func(*Engine)
+
+// WithClock replaces the clock that tells which markdowns are in effect
+func WithClock(now func() time.Time) Option {
+	return func(e *Engine) {
+		e.now = now
+	}
+}
+
+func NewEngine(rules []Rule, options ...Option) Engine {
+	e := Engine{rules: rules, now: time.Now}
+	for _, option := range options {
+		option(&e)
+	}
+	return e
+}
+
+// Markdown is the step of the schedule with the largest discount that has started
+func (e Engine) Markdown(p model.Product) (model.Markdown, bool) {
+	now := e.now()
+	best, found := model.Markdown{}, false
+	for _, step := range e.Schedule(p) {
+		if !step.StartsAt.After(now) && (!found || step.Percent > best.Percent) {
+			best, found = step, true
+		}
+	}
+	return best, found
+}
+
+// Schedule lists the markdown steps of the product, a product that does not expire has none
+func (e Engine) Schedule(p model.Product) []model.Markdown {
+	if p.Expiry.IsZero() {
+		return []model.Markdown{}
+	}
+	rules := e.rulesOf(p.CategoryId)
+	steps := make([]model.Markdown, len(rules))
+	for i, rule := range rules {
+		steps[i] = model.Markdown{
+			ProductId: p.Id,
+			Percent:   rule.Percent,
+			ListPrice: p.Price,
+			Price:     markDown(p.Price, rule.Percent),
+			StartsAt:  p.Expiry.Add(-rule.before()),
+		}
+	}
+	sort.Slice(steps, func(i, j int) bool {
+		return steps[i].StartsAt.Before(steps[j].StartsAt)
+	})
+	return steps
+}
+
+// horizon is how long before its expiry a product can first be marked down
+func (e Engine) horizon() time.Duration {
+	var longest time.Duration
+	for _, rule := range e.rules {
+		if rule.before() > longest {
+			longest = rule.before()
+		}
+	}
+	return longest
+}
+
+func (e Engine) rulesOf(categoryId int) []Rule {
+	var own, general []Rule
+	for _, rule := range e.rules {
+		switch rule.CategoryId {
+		case categoryId:
+			own = append(own, rule)
+		case 0:
+			general = append(general, rule)
+		}
+	}
+	if len(own) > 0 {
+		return own
+	}
+	return general
+}
+
+// markDown takes percent off price, rounded to the cent
+func markDown(price float32, percent float64) float32 {
+	cents := math.Round(float64(price) * (100 - percent))
+	return float32(cents / 100)
+}
@@ -0,0 +1,95 @@
+package pricing
+
+import (
+	"github.com/stretchr/testify/assert"
+	"rest/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+var now = time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+
+func clock() time.Time {
+	return now
+}
+
+func TestMarkdownTakesTheLargestStepThatStarted(t *testing.T) {
+
+	engine := NewEngine([]Rule{{Days: 3, Percent: 20}, {Days: 1, Percent: 50}}, WithClock(clock))
+	prod := model.Product{Id: 3, Price: 2.99, CategoryId: 2}
+
+	prod.Expiry = now.Add(5 * 24 * time.Hour)
+	_, ok := engine.Markdown(prod)
+	assert.False(t, ok, "no markdown is expected five days ahead")
+
+	prod.Expiry = now.Add(2 * 24 * time.Hour)
+	markdown, _ := engine.Markdown(prod)
+	assert.Equal(t, model.Markdown{ProductId: 3, Percent: 20, ListPrice: 2.99, Price: 2.39, StartsAt: now.Add(-24 * time.Hour)}, markdown, "20% off rounded to the cent is expected")
+
+	prod.Expiry = now.Add(12 * time.Hour)
+	markdown, _ = engine.Markdown(prod)
+	assert.Equal(t, float32(1.5), markdown.Price, "50% off is expected on the last day")
+}
+
+func TestCategoryRulesReplaceTheGeneralOnes(t *testing.T) {
+
+	engine := NewEngine([]Rule{{Days: 3, Percent: 20}, {CategoryId: 4, Days: 1, Percent: 30}}, WithClock(clock))
+	expiry := now.Add(2 * 24 * time.Hour)
+
+	_, ok := engine.Markdown(model.Product{Price: 10, CategoryId: 4, Expiry: expiry})
+	assert.False(t, ok, "only the rule of the category is expected to apply")
+	markdown, _ := engine.Markdown(model.Product{Price: 10, CategoryId: 5, Expiry: expiry})
+	assert.Equal(t, float64(20), markdown.Percent, "the general rule is expected for other categories")
+}
+
+func TestScheduleOfAProductWithoutExpiry(t *testing.T) {
+
+	engine := NewEngine([]Rule{{Days: 3, Percent: 20}}, WithClock(clock))
+
+	assert.Empty(t, engine.Schedule(model.Product{Price: 10}), "no markdown is expected")
+}
+
+func TestParseRulesFailureWithBadPercent(t *testing.T) {
+
+	_, err := ParseRules(strings.NewReader(`[{"days": 3, "percent": 120}]`))
+
+	assert.NotNil(t, err, "an error is expected")
+}
+
+type fakeProducts struct {
+	model.Datastore
+	products []model.Product
+	query    model.ProductQuery
+}
+
+func (f *fakeProducts) GetCategorisedProducts(q model.ProductQuery) ([]model.Product, error) {
+	f.query = q
+	return f.products, nil
+}
+
+type fakeMarkdowns struct {
+	model.MarkdownDatastore
+	recorded []model.Markdown
+}
+
+func (f *fakeMarkdowns) RecordMarkdown(m *model.Markdown) error {
+	f.recorded = append(f.recorded, *m)
+	return nil
+}
+
+func TestRecordStoresTheMarkdownsInEffect(t *testing.T) {
+
+	engine := NewEngine([]Rule{{Days: 3, Percent: 20}}, WithClock(clock))
+	products := &fakeProducts{products: []model.Product{
+		{Id: 3, Price: 10, Expiry: now.Add(24 * time.Hour)},
+		{Id: 4, Price: 10, Expiry: now.Add(4 * 24 * time.Hour)},
+	}}
+	markdowns := &fakeMarkdowns{}
+	recorded, err := NewRecorder(products, markdowns, engine).Record()
+
+	assert.Nil(t, err, "no error is expected")
+	assert.Equal(t, 1, recorded, "one product is expected to be marked down")
+	assert.Equal(t, 3, markdowns.recorded[0].ProductId, "the markdown of the product due first is expected")
+	assert.Equal(t, []interface{}{now.Add(3 * 24 * time.Hour)}, products.query.Filters[1].Values, "only products within the longest rule are expected to be read")
+}
@@ -0,0 +1,62 @@
+package pricing
+
+import (
+	"context"
+	"log"
+	"rest/model"
+	"time"
+)
+
+// Recorder keeps the history of markdowns: every run it stores the markdown in effect for each product
+// that has one, so a markdown is recorded once when it takes effect and kept after it ends
+type Recorder struct {
+	products  model.Datastore
+	markdowns model.MarkdownDatastore
+	engine    Engine
+}
+
+func NewRecorder(products model.Datastore, markdowns model.MarkdownDatastore, engine Engine) Recorder {
+	return Recorder{products: products, markdowns: markdowns, engine: engine}
+}
+
+// Record stores the markdowns in effect now and tells how many products have one. It only reads the
+// products close enough to their expiry to be marked down
+func (r Recorder) Record() (int, error) {
+	now := r.engine.now()
+	q := model.ProductQuery{Filters: []model.Filter{
+		{Field: "expiry", Op: model.OpGt, Values: []interface{}{now}},
+		{Field: "expiry", Op: model.OpLte, Values: []interface{}{now.Add(r.engine.horizon())}},
+	}}
+	products, err := r.products.GetCategorisedProducts(q)
+	if err != nil {
+		return 0, err
+	}
+	recorded := 0
+	for _, p := range products {
+		markdown, ok := r.engine.Markdown(p)
+		if !ok {
+			continue
+		}
+		if err := r.markdowns.RecordMarkdown(&markdown); err != nil {
+			return recorded, err
+		}
+		recorded++
+	}
+	return recorded, nil
+}
+
+// Run records right away and then every interval until ctx is done
+func (r Recorder) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := r.Record(); err != nil {
+			log.Printf("markdown history: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}